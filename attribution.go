@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xyproto/ollamaclient/v2"
+)
+
+// maxAttributionLength is the longest attribution that is accepted, in runes
+const maxAttributionLength = 60
+
+// attributionPrompt asks for an attribution for the fortune, as JSON, so that it can be
+// parsed without guessing where the fortune ends and the attribution begins
+const attributionPrompt = `Here is a fortune, like the ones from the fortune-mod application on Linux:
+
+%s
+
+Invent a short and plausible attribution for it, in the same style, like "Ancient Borg proverb" or "a tired sysadmin". Do not use the name of a real person. Only output JSON, like this: {"attribution": "a tired sysadmin"}`
+
+// errNoAttribution is returned when the LLM did not come up with an attribution that could be parsed
+var errNoAttribution = errors.New("could not generate an attribution")
+
+// unmarshalAnswer decodes the JSON object in the output from the LLM, ignoring any text around it
+func unmarshalAnswer(s string, v any) error {
+	start, end := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("no JSON object in %q", s)
+	}
+	return json.Unmarshal([]byte(s[start:end+1]), v)
+}
+
+// parseAttribution extracts the attribution from the JSON object in the output from the LLM
+func parseAttribution(s string) (string, error) {
+	var answer struct {
+		Attribution string `json:"attribution"`
+	}
+	if err := unmarshalAnswer(s, &answer); err != nil {
+		return "", err
+	}
+	attribution := strings.TrimSpace(answer.Attribution)
+	attribution = strings.TrimSpace(strings.TrimLeft(attribution, "—–-~ "))
+	attribution = strings.Trim(attribution, "\"'“”‘’")
+	switch {
+	case attribution == "":
+		return "", errors.New("empty attribution")
+	case strings.ContainsAny(attribution, "\n{}"):
+		return "", fmt.Errorf("malformed attribution: %q", attribution)
+	case len([]rune(attribution)) > maxAttributionLength:
+		return "", fmt.Errorf("too long attribution: %q", attribution)
+	}
+	return attribution, nil
+}
+
+// generateAttribution asks the LLM for a plausible attribution for the fortune, like "Ancient Borg proverb".
+// Attributions with words from the given blocklist are not used. errNoAttribution is returned if no usable
+// attribution was generated after a few tries.
+func generateAttribution(oc *ollamaclient.Config, fortune string, bl *blocklist) (string, error) {
+	prompt := fmt.Sprintf(attributionPrompt, fortune)
+	for range 3 {
+		resp, err := oc.GetResponse(prompt)
+		if err != nil {
+			return "", err
+		}
+		if attribution, err := parseAttribution(resp.Response); err == nil && len(bl.find(attribution)) == 0 {
+			return attribution, nil
+		}
+	}
+	return "", errNoAttribution
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	cardWidth      = 1200 // pixels
+	cardPadding    = 100  // pixels between the edges and the text
+	cardAccentBar  = 16   // the width of the accent bar to the left, in pixels
+	cardFontSize   = 44   // points, at 72 DPI
+	cardFooterSize = 22   // points, at 72 DPI
+	cardWrapWidth  = 40   // the width that the fortune is wrapped for, in cells
+)
+
+// cardTheme is the colors of a fortune card
+type cardTheme struct {
+	background, foreground, accent string // hex colors, like "#1e1e2e"
+}
+
+// defaultCardTheme is used when no style has a card theme
+var defaultCardTheme = cardTheme{"#1e1e2e", "#f5f5f5", "#89b4fa"}
+
+// cardThemes are the card themes for the styles. When several styles are selected,
+// the first one in this list is used.
+var cardThemes = []struct {
+	style string
+	theme cardTheme
+}{
+	{"borg", cardTheme{"#0b0f0b", "#7cfc00", "#2e8b57"}},
+	{"praise", cardTheme{"#fffaf0", "#3b2f00", "#d4af37"}},
+	{"evil", cardTheme{"#1a0000", "#ffdddd", "#cc0000"}},
+	{"good", cardTheme{"#f0fbff", "#06324a", "#20a4d8"}},
+	{"romantic", cardTheme{"#fff0f5", "#5a1030", "#ff5fa2"}},
+	{"cats", cardTheme{"#fff4e6", "#4a2c00", "#ff9900"}},
+	{"dogs", cardTheme{"#f7efe6", "#3e2a17", "#c08a4a"}},
+	{"pirate", cardTheme{"#2b1d0e", "#f4e3c1", "#c9a227"}},
+	{"scifi", cardTheme{"#0d0221", "#e0d7ff", "#a259ff"}},
+	{"robot", cardTheme{"#eef2f5", "#1c2833", "#3498db"}},
+}
+
+// pickCardTheme returns the card theme that fits the selected styles
+func pickCardTheme(selected []string) cardTheme {
+	for _, ct := range cardThemes {
+		if slices.Contains(selected, ct.style) {
+			return ct.theme
+		}
+	}
+	return defaultCardTheme
+}
+
+// parseHexColor parses a color like "#1e1e2e"
+func parseHexColor(s string) color.RGBA {
+	var r, g, b uint8
+	fmt.Sscanf(s, "#%02x%02x%02x", &r, &g, &b)
+	return color.RGBA{r, g, b, 0xff}
+}
+
+// card is a fortune laid out on a card, with a footer that lists the styles
+type card struct {
+	lines       []string
+	attribution string // a right-aligned line below the fortune, or an empty string
+	footer      string
+	theme       cardTheme
+}
+
+// newCard lays out the fortune using the poetic line breaks
+func newCard(fortune, attribution string, selected []string) *card {
+	footer := "FortuneCraft"
+	if len(selected) > 0 {
+		footer += " · " + strings.Join(selected, ", ")
+	}
+	c := &card{
+		lines:  wrapLines(fortune, cardWrapWidth, 0),
+		footer: footer,
+		theme:  pickCardTheme(selected),
+	}
+	if attribution != "" {
+		c.attribution = "— " + attribution
+	}
+	return c
+}
+
+// textLines returns the number of lines of text on the card, including the attribution
+func (c *card) textLines() int {
+	if c.attribution != "" {
+		return len(c.lines) + 1
+	}
+	return len(c.lines)
+}
+
+// height returns the height of the card in pixels, for the given font size
+func (c *card) height(fontSize float64) int {
+	return 2*cardPadding + int(float64(c.textLines())*fontSize*1.4) + 2*cardFooterSize
+}
+
+// newFace loads one of the bundled Go fonts in the given size
+func newFace(ttf []byte, size float64) (font.Face, error) {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, err
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// fontSize returns the font size for the fortune, which is smaller than cardFontSize
+// if the widest line, like a long word that could not be wrapped, does not fit otherwise
+func (c *card) fontSize() (float64, error) {
+	face, err := newFace(goregular.TTF, cardFontSize)
+	if err != nil {
+		return 0, err
+	}
+	available := fixed.I(cardWidth - 2*cardPadding)
+	widest := fixed.I(0)
+	for _, line := range append(slices.Clone(c.lines), c.attribution) {
+		widest = max(widest, font.MeasureString(face, line))
+	}
+	if widest > available {
+		return cardFontSize * float64(available) / float64(widest), nil
+	}
+	return cardFontSize, nil
+}
+
+// writePNG draws the card and writes it as a PNG image
+func (c *card) writePNG(filename string) error {
+	fontSize, err := c.fontSize()
+	if err != nil {
+		return err
+	}
+	face, err := newFace(goregular.TTF, fontSize)
+	if err != nil {
+		return err
+	}
+	footerFace, err := newFace(goitalic.TTF, cardFooterSize)
+	if err != nil {
+		return err
+	}
+
+	height := c.height(fontSize)
+	img := image.NewRGBA(image.Rect(0, 0, cardWidth, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(parseHexColor(c.theme.background)), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, cardAccentBar, height), image.NewUniform(parseHexColor(c.theme.accent)), image.Point{}, draw.Src)
+
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(parseHexColor(c.theme.foreground)), Face: face}
+	lineHeight := fontSize * 1.4
+	for i, line := range c.lines {
+		d.Dot = fixed.P(cardPadding, cardPadding+int(fontSize+float64(i)*lineHeight))
+		d.DrawString(line)
+	}
+	if c.attribution != "" {
+		right := fixed.I(cardWidth - cardPadding)
+		d.Dot = fixed.Point26_6{X: right - font.MeasureString(face, c.attribution), Y: fixed.I(cardPadding + int(fontSize+float64(len(c.lines))*lineHeight))}
+		d.DrawString(c.attribution)
+	}
+	d = &font.Drawer{Dst: img, Src: image.NewUniform(parseHexColor(c.theme.accent)), Face: footerFace}
+	d.Dot = fixed.P(cardPadding, height-cardPadding/2)
+	d.DrawString(c.footer)
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// xmlEscape escapes text for use in SVG
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// writeSVG writes the card as an SVG image, with the bundled font embedded
+func (c *card) writeSVG(filename string) error {
+	fontSize, err := c.fontSize()
+	if err != nil {
+		return err
+	}
+	height := c.height(fontSize)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", cardWidth, height, cardWidth, height)
+	sb.WriteString("<style>\n")
+	fmt.Fprintf(&sb, "@font-face { font-family: \"Go\"; font-style: normal; src: url(data:font/ttf;base64,%s); }\n", base64.StdEncoding.EncodeToString(goregular.TTF))
+	fmt.Fprintf(&sb, "@font-face { font-family: \"Go\"; font-style: italic; src: url(data:font/ttf;base64,%s); }\n", base64.StdEncoding.EncodeToString(goitalic.TTF))
+	fmt.Fprintf(&sb, ".fortune { font-family: \"Go\", sans-serif; font-size: %.1fpx; fill: %s; }\n", fontSize, c.theme.foreground)
+	fmt.Fprintf(&sb, ".footer { font-family: \"Go\", sans-serif; font-style: italic; font-size: %dpx; fill: %s; }\n", cardFooterSize, c.theme.accent)
+	sb.WriteString("</style>\n")
+	fmt.Fprintf(&sb, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", c.theme.background)
+	fmt.Fprintf(&sb, "<rect width=\"%d\" height=\"100%%\" fill=\"%s\"/>\n", cardAccentBar, c.theme.accent)
+	fmt.Fprintf(&sb, "<text class=\"fortune\" x=\"%d\" y=\"%d\" xml:space=\"preserve\">\n", cardPadding, cardPadding)
+	for i, line := range c.lines {
+		dy := "1em"
+		if i > 0 {
+			dy = "1.4em"
+		}
+		fmt.Fprintf(&sb, "<tspan x=\"%d\" dy=\"%s\">%s</tspan>\n", cardPadding, dy, xmlEscape(line))
+	}
+	if c.attribution != "" {
+		fmt.Fprintf(&sb, "<tspan x=\"%d\" dy=\"1.4em\" text-anchor=\"end\">%s</tspan>\n", cardWidth-cardPadding, xmlEscape(c.attribution))
+	}
+	sb.WriteString("</text>\n")
+	fmt.Fprintf(&sb, "<text class=\"footer\" x=\"%d\" y=\"%d\">%s</text>\n", cardPadding, height-cardPadding/2, xmlEscape(c.footer))
+	sb.WriteString("</svg>\n")
+	return os.WriteFile(filename, []byte(sb.String()), 0o644)
+}
+
+// renderCard writes the fortune, and the attribution if it is not empty, as a card to a .png or .svg file
+func renderCard(filename, fortune, attribution string, selected []string) error {
+	c := newCard(fortune, attribution, selected)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".png":
+		return c.writePNG(filename)
+	case ".svg":
+		return c.writeSVG(filename)
+	}
+	return fmt.Errorf("can only render .png or .svg files, not %s", filename)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// clicheRule rejects fortunes with phrasings that language models use too often, like "tapestry"
+type clicheRule struct {
+	cliches *phraseList
+}
+
+// newClicheRule loads cliches.txt from the built-in configuration and the configuration directories
+func newClicheRule() (*clicheRule, error) {
+	cliches, err := loadPhraseList("cliches.txt")
+	if err != nil {
+		return nil, err
+	}
+	return &clicheRule{cliches}, nil
+}
+
+func (cr *clicheRule) name() string { return "cliche" }
+
+func (cr *clicheRule) score(s string, _ bool) (float64, string) {
+	found := cr.cliches.findFold(s)
+	if len(found) == 0 {
+		return 0, ""
+	}
+	return float64(len(found)), "contains the cliché " + strings.Join(found, ", ")
+}
+
+// hint asks the LLM to avoid the clichés that were found
+func (cr *clicheRule) hint(s string) string {
+	return fmt.Sprintf("Avoid clichés like %s!", strings.Join(cr.cliches.findFold(s), ", "))
+}
+
+// normalizeQuote lowercases the string and keeps only letters and digits, with single spaces between words
+func normalizeQuote(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// famousQuoteRule rejects fortunes that are mostly a famous quote, returned as it is
+type famousQuoteRule struct {
+	quotes     []string // the quotes, as they are written in the configuration files
+	normalized []string // the quotes, normalized with normalizeQuote
+}
+
+// newFamousQuoteRule loads famous_quotes.txt from the built-in configuration and the configuration directories
+func newFamousQuoteRule() (*famousQuoteRule, error) {
+	pl, err := loadPhraseList("famous_quotes.txt")
+	if err != nil {
+		return nil, err
+	}
+	fr := &famousQuoteRule{quotes: pl.phrases}
+	for _, quote := range pl.phrases {
+		fr.normalized = append(fr.normalized, normalizeQuote(quote))
+	}
+	return fr, nil
+}
+
+func (fr *famousQuoteRule) name() string { return "famous_quote" }
+
+// find returns the famous quote that makes up most of the fortune, or an empty string.
+// A fortune that only borrows a famous quote, and adds a twist to it, is not rejected.
+func (fr *famousQuoteRule) find(s string) string {
+	fortune := normalizeQuote(s)
+	for i, quote := range fr.normalized {
+		if quote != "" && strings.Contains(fortune, quote) && len(quote)*10 >= len(fortune)*7 {
+			return fr.quotes[i]
+		}
+	}
+	return ""
+}
+
+func (fr *famousQuoteRule) score(s string, _ bool) (float64, string) {
+	if quote := fr.find(s); quote != "" {
+		return 1, fmt.Sprintf("is the famous quote %q", quote)
+	}
+	return 0, ""
+}
+
+// hint asks the LLM for something original instead of the famous quote
+func (fr *famousQuoteRule) hint(s string) string {
+	return fmt.Sprintf("Write something original, and not a famous quote like %q!", strings.TrimRight(fr.find(s), ".!?"))
+}
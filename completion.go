@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// finishPrompt asks the LLM to finish a fortune that was cut off
+const finishPrompt = `Here is the start of a fortune, like the ones from the fortune-mod application on Linux, but it was cut off:
+
+%s
+
+Finish it, with as few words as possible. Only output the whole fortune, in plain text.`
+
+// generateResult is the last line of a response from /api/generate, with why the generation stopped
+// and how long it took. The Ollama client does not return these, so they are decoded from the
+// response body while the client reads it.
+type generateResult struct {
+	Done         bool   `json:"done"`
+	DoneReason   string `json:"done_reason"`
+	EvalCount    int    `json:"eval_count"`
+	EvalDuration int64  `json:"eval_duration"` // in nanoseconds
+}
+
+// generateObserver is an HTTP transport that keeps the last line of the latest response from /api/generate
+type generateObserver struct {
+	next   http.RoundTripper
+	mut    sync.Mutex
+	result *generateResult
+}
+
+// generateResults is the observer for the responses from /api/generate
+var generateResults = &generateObserver{}
+
+// observeGenerate puts generateResults in front of the default HTTP transport, which the Ollama
+// client uses, the first time it is called
+var observeGenerate = sync.OnceFunc(func() {
+	generateResults.next = http.DefaultTransport
+	http.DefaultTransport = generateResults
+})
+
+func (o *generateObserver) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := o.next.RoundTrip(req)
+	if err != nil || req.URL.Path != "/api/generate" {
+		return resp, err
+	}
+	resp.Body = &observedBody{ReadCloser: resp.Body, observer: o}
+	return resp, nil
+}
+
+// reset forgets the latest result, before a new prompt is sent
+func (o *generateObserver) reset() {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	o.result = nil
+}
+
+// latest returns the result of the latest response, or nil if no response was received since the reset,
+// like when the client used a cached response
+func (o *generateObserver) latest() *generateResult {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	return o.result
+}
+
+// observe decodes one line of a response, and keeps it if it is the last one
+func (o *generateObserver) observe(line []byte) {
+	var result generateResult
+	if json.Unmarshal(line, &result) != nil || !result.Done {
+		return
+	}
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	o.result = &result
+}
+
+// observedBody passes each line of a response body to the observer, while the body is being read
+type observedBody struct {
+	io.ReadCloser
+	observer *generateObserver
+	line     []byte // the line that has been read so far
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.line = append(b.line, p[:n]...)
+	for {
+		i := bytes.IndexByte(b.line, '\n')
+		if i < 0 {
+			break
+		}
+		b.observer.observe(b.line[:i])
+		b.line = b.line[i+1:]
+	}
+	if err == io.EOF {
+		b.flush()
+	}
+	return n, err
+}
+
+// Close also observes the last line, since a response without streaming may not end with a newline,
+// and the client may stop reading before the end of the body
+func (b *observedBody) Close() error {
+	b.flush()
+	return b.ReadCloser.Close()
+}
+
+// flush observes the line that has been read so far
+func (b *observedBody) flush() {
+	if len(bytes.TrimSpace(b.line)) > 0 {
+		b.observer.observe(b.line)
+	}
+	b.line = nil
+}
+
+// completion is the output from the LLM, and why the generation stopped
+type completion struct {
+	text       string
+	tokens     int
+	doneReason string // "stop" if the LLM was done, "length" if it was cut off, or empty if it is not known
+}
+
+// truncated checks if the LLM was cut off before it was done, by the token limit or by the context length
+// of the model. Older versions of Ollama, and cached responses, do not tell why the generation stopped.
+func (c *completion) truncated() bool {
+	return c.doneReason == "length"
+}
+
+// danglingWords are English words that a finished sentence rarely ends with
+var danglingWords = []string{
+	"a", "an", "the", "and", "or", "but", "nor", "so", "yet", "because", "although", "than", "that", "which",
+	"who", "whose", "if", "when", "while", "of", "to", "with", "in", "on", "at", "by", "from", "for", "into",
+	"my", "your", "his", "her", "its", "our", "their", "is", "are", "was", "were",
+}
+
+// brackets are the pairs of brackets and quotes that must be balanced. The curly double quotes are
+// checked by unclosedQuote, since languages pair them up differently.
+var brackets = []struct{ open, close string }{
+	{"(", ")"}, {"[", "]"}, {"{", "}"}, {"«", "»"}, {"「", "」"},
+}
+
+// unclosedQuote returns the curly double quote that is never closed, or an empty string.
+// English quotes like “this”, German, Czech and Polish like „this“ or „this”, and Swedish and Finnish like ”this”.
+func unclosedQuote(s string) string {
+	low, left, right := strings.Count(s, "„"), strings.Count(s, "“"), strings.Count(s, "”")
+	switch {
+	case low > 0 && low > left+right:
+		return "„"
+	case low == 0 && left > right:
+		return "“"
+	case low == 0 && left == 0 && right%2 == 1:
+		return "”"
+	}
+	return ""
+}
+
+// sadEmoticons matches emoticons like :( and :-[, which open brackets that are not meant to be closed
+var sadEmoticons = regexp.MustCompile(`[:;=]'?-?[(\[{]`)
+
+// completenessRule rejects fortunes that look like they were cut off in the middle of a sentence,
+// like a fortune that ends with "and" or a comma, or that has a quote or a bracket that is never closed
+type completenessRule struct{}
+
+func (cr *completenessRule) name() string { return "incomplete" }
+
+func (cr *completenessRule) score(s string, _ bool) (float64, string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ""
+	}
+	withoutEmoticons := sadEmoticons.ReplaceAllString(s, "")
+	for _, b := range brackets {
+		if strings.Count(withoutEmoticons, b.open) > strings.Count(withoutEmoticons, b.close) {
+			return 1, fmt.Sprintf("has an unclosed %s", b.open)
+		}
+	}
+	if quote := unclosedQuote(s); quote != "" {
+		return 1, fmt.Sprintf("has an unclosed %s", quote)
+	}
+	if strings.Count(s, "\"")%2 == 1 {
+		return 1, "has an unclosed \""
+	}
+	last, _ := utf8.DecodeLastRuneInString(s)
+	if strings.ContainsRune(",;:-–—", last) {
+		return 1, fmt.Sprintf("ends with %q", string(last))
+	}
+	words := strings.Fields(s)
+	if word := words[len(words)-1]; slices.Contains(danglingWords, word) {
+		return 1, fmt.Sprintf("ends with %q", word)
+	}
+	// poems and short quips may end without a punctuation mark, so this is not enough on its own
+	if unicode.IsLetter(last) || unicode.IsDigit(last) {
+		return 0.5, "does not end with a punctuation mark"
+	}
+	return 0, ""
+}
+
+// hint asks the LLM for a complete fortune
+func (cr *completenessRule) hint(string) string {
+	return "Write complete sentences, and finish the fortune!"
+}
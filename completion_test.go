@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestCompletenessRule(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"The cat sat on the keyboard, and the code compiled.", 0},
+		{"The cat sat on the keyboard, and", 1},
+		{"The cat sat on the keyboard,", 1},
+		{"Monday again :( but coffee helps.", 0},
+		{"It was (not that bad.", 1},
+		{"He said “never again” and left.", 0},
+		{"He said “never again and left.", 1},
+		{"„Das ist gut“, sagte der Hund.", 0},
+		{"„To je dobré”, řekl pes.", 0},
+		{"„Das ist gut, sagte der Hund.", 1},
+		{"”Det är bra”, sa hunden.", 0},
+		{"”Det är bra, sa hunden.", 1},
+		{"Roses are red", 0.5},
+	}
+	cr := &completenessRule{}
+	for _, tt := range tests {
+		if got, reason := cr.score(tt.s, false); got != tt.want {
+			t.Errorf("score(%q) = %g (%s), want %g", tt.s, got, reason, tt.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/env/v2"
+)
+
+// defaultConfig contains the built-in configuration files, in the same format as the files in the configuration directories
+//
+//go:embed defaults/*.txt
+var defaultConfig embed.FS
+
+// configDirs returns the directories that may contain configuration files. The system-wide directory
+// comes first, so that the configuration of the user can add to it and remove from it.
+func configDirs() []string {
+	userConfig := env.Dir("XDG_CONFIG_HOME", filepath.Join(env.HomeDir(), ".config"))
+	return []string{"/etc/fortunecraft", filepath.Join(userConfig, "fortunecraft")}
+}
+
+// phraseList is a list of phrases and regular expressions to look for in a fortune
+type phraseList struct {
+	phrases []string
+	regexps []*regexp.Regexp
+	scores  map[string]float64 // the scores of the phrases and regular expressions that have a score of their own
+}
+
+// cutScore splits a line like "content = 0.4" into the entry and the score. Lines without a score are returned as they are.
+func cutScore(line string) (string, float64, bool) {
+	i := strings.LastIndex(line, " = ")
+	if i < 0 {
+		return line, 0, false
+	}
+	score, err := strconv.ParseFloat(strings.TrimSpace(line[i+3:]), 64)
+	if err != nil {
+		return line, 0, false
+	}
+	return strings.TrimSpace(line[:i]), score, true
+}
+
+// applyLine adds or removes a phrase or a regular expression, given a line from a configuration file.
+// Lines that start with "re:" are regular expressions, and lines that start with "-" remove an entry.
+// A phrase can be quoted, to keep spaces at the start or the end. A line that ends with " = " and a number,
+// like "content = 0.4", gives the entry a score of its own, instead of the score of the rule.
+func (pl *phraseList) applyLine(line string) error {
+	remove := strings.HasPrefix(line, "-")
+	line = strings.TrimPrefix(line, "-")
+	line, score, hasScore := cutScore(line)
+	if expr, ok := strings.CutPrefix(line, "re:"); ok {
+		delete(pl.scores, "re:"+expr)
+		if remove {
+			pl.regexps = slices.DeleteFunc(pl.regexps, func(re *regexp.Regexp) bool { return re.String() == expr })
+			return nil
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		pl.regexps = append(pl.regexps, re)
+		pl.setScore("re:"+expr, score, hasScore)
+		return nil
+	}
+	if strings.HasPrefix(line, "\"") {
+		unquoted, err := strconv.Unquote(line)
+		if err != nil {
+			return fmt.Errorf("invalid quoted phrase: %s", line)
+		}
+		line = unquoted
+	}
+	delete(pl.scores, line)
+	if remove {
+		pl.phrases = slices.DeleteFunc(pl.phrases, func(phrase string) bool { return phrase == line })
+		return nil
+	}
+	if !slices.Contains(pl.phrases, line) {
+		pl.phrases = append(pl.phrases, line)
+	}
+	pl.setScore(line, score, hasScore)
+	return nil
+}
+
+// setScore gives a phrase, or a regular expression prefixed with "re:", a score of its own
+func (pl *phraseList) setScore(key string, score float64, hasScore bool) {
+	if !hasScore {
+		return
+	}
+	if pl.scores == nil {
+		pl.scores = make(map[string]float64)
+	}
+	pl.scores[key] = score
+}
+
+// applyFile applies each line in the file to the list. Empty lines and lines starting with "#" are skipped.
+// A file that does not exist is not an error.
+// The path is only used in error messages.
+func (pl *phraseList) applyFile(fsys fs.FS, filename, path string) error {
+	f, err := fsys.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := pl.applyLine(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// loadPhraseList applies the built-in file with the given name, and then the files with the same name
+// in the configuration directories, in order
+func loadPhraseList(name string) (*phraseList, error) {
+	pl := &phraseList{}
+	if err := pl.applyFile(defaultConfig, "defaults/"+name, "defaults/"+name); err != nil {
+		return nil, err
+	}
+	for _, dir := range configDirs() {
+		if err := pl.applyFile(os.DirFS(dir), name, filepath.Join(dir, name)); err != nil {
+			return nil, err
+		}
+	}
+	return pl, nil
+}
+
+// find returns the phrases and regular expressions that are found in the string, quoted for display
+func (pl *phraseList) find(s string) []string {
+	return pl.findWith(s, strings.Contains)
+}
+
+// findFold works like find, but the phrases are found regardless of case
+func (pl *phraseList) findFold(s string) []string {
+	return pl.findWith(s, func(s, phrase string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(phrase))
+	})
+}
+
+// phraseMatch is a phrase or a regular expression that was found in a string
+type phraseMatch struct {
+	key     string // the phrase, or the regular expression prefixed with "re:"
+	display string // the quoted phrase, or the regular expression between slashes
+}
+
+// matches returns the phrases that the contains function finds in the string, and the regular expressions that match it
+func (pl *phraseList) matches(s string, contains func(s, phrase string) bool) []phraseMatch {
+	var found []phraseMatch
+	for _, phrase := range pl.phrases {
+		if contains(s, phrase) {
+			found = append(found, phraseMatch{phrase, strconv.Quote(phrase)})
+		}
+	}
+	for _, re := range pl.regexps {
+		if re.MatchString(s) {
+			found = append(found, phraseMatch{"re:" + re.String(), "/" + re.String() + "/"})
+		}
+	}
+	return found
+}
+
+// findWith returns the phrases that the contains function finds in the string, and the regular
+// expressions that match it, quoted for display
+func (pl *phraseList) findWith(s string, contains func(s, phrase string) bool) []string {
+	var found []string
+	for _, m := range pl.matches(s, contains) {
+		found = append(found, m.display)
+	}
+	return found
+}
+
+// score adds up the scores of the phrases and regular expressions that are found in the string, where
+// the entries without a score of their own get the default score, and returns them quoted for display
+func (pl *phraseList) score(s string, defaultScore float64) (float64, []string) {
+	var (
+		total float64
+		found []string
+	)
+	for _, m := range pl.matches(s, strings.Contains) {
+		if score, ok := pl.scores[m.key]; ok {
+			total += score
+		} else {
+			total += defaultScore
+		}
+		found = append(found, m.display)
+	}
+	return total, found
+}
+
+// blocklist is a list of words and regular expressions that must never appear in a fortune.
+// Words are matched as whole words, regardless of case.
+type blocklist struct {
+	regexps []*regexp.Regexp
+}
+
+// loadBlocklist loads blocklist.txt from the configuration directories. There is no built-in blocklist.
+func loadBlocklist() (*blocklist, error) {
+	pl, err := loadPhraseList("blocklist.txt")
+	if err != nil {
+		return nil, err
+	}
+	bl := &blocklist{regexps: pl.regexps}
+	for _, word := range pl.phrases {
+		// \W only knows about ASCII, so the word boundaries are spelled out for all scripts
+		bl.regexps = append(bl.regexps, regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}_])`+regexp.QuoteMeta(word)+`([^\p{L}\p{N}_]|$)`))
+	}
+	return bl, nil
+}
+
+// find returns the blocked words that are found in the string, quoted for display
+func (bl *blocklist) find(s string) []string {
+	var found []string
+	for _, re := range bl.regexps {
+		if match := re.FindString(s); match != "" {
+			found = append(found, strconv.Quote(strings.TrimFunc(match, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })))
+		}
+	}
+	return found
+}
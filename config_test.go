@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "fortunecraft"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fortunecraft", "blocklist.txt"), []byte("кот\nmonday\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bl, err := loadBlocklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"Котлета для кота.", nil},
+		{"Кот всегда прав.", []string{`"Кот"`}},
+		{"Ах, этот кот!", []string{`"кот"`}},
+		{"Mondays are for cats.", nil},
+		{"Never trust a Monday.", []string{`"Monday"`}},
+		{"Montag, or Monday_2, is fine.", nil},
+	}
+	for _, tt := range tests {
+		if got := bl.find(tt.s); !slices.Equal(got, tt.want) {
+			t.Errorf("find(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// constraintRule is a machine-checkable constraint that a style puts on the fortune, like "no emojis".
+// A fortune that does not satisfy the constraint is rejected, and the hint is added to the prompt.
+type constraintRule struct {
+	ruleName    string
+	description string
+	hintText    string
+	ok          func(s string) bool
+}
+
+func (cr *constraintRule) name() string { return cr.ruleName }
+
+func (cr *constraintRule) score(s string, _ bool) (float64, string) {
+	if cr.ok(s) {
+		return 0, ""
+	}
+	return 1, "does not " + cr.description
+}
+
+func (cr *constraintRule) hint(string) string { return cr.hintText }
+
+// styleConstraints are the constraints of the styles that do not depend on the keyword or the user
+var styleConstraints = []struct {
+	style      string
+	constraint *constraintRule
+}{
+	{"borg", &constraintRule{"no_emojis", "avoid emojis", "Do not use any emojis!", hasNoEmojis}},
+	{"international", &constraintRule{"not_english", "avoid English", "Write it in another language than English!", isNotEnglish}},
+	{"leet", &constraintRule{"leetspeak", "use leetspeak", "Write in 1337speak, with numbers instead of letters, like h4ck3r!", isLeetspeak}},
+}
+
+// constraintRules returns the constraints for the selected styles, the keyword, the name of the user and
+// the language. The keyword, the name and the language are only required if they are not empty, and the
+// keyword is only required if the fortune is in English.
+func constraintRules(selected []string, keyword, userName, lang string) []rule {
+	var rules []rule
+	for _, sc := range styleConstraints {
+		if slices.Contains(selected, sc.style) {
+			rules = append(rules, sc.constraint)
+		}
+	}
+	// the keyword is usually translated in fortunes that are not in English, so then it can not be checked
+	english := (lang == "" || lang == "en") && !slices.Contains(selected, "international")
+	if keyword = strings.TrimSpace(keyword); keyword != "" && english {
+		rules = append(rules, &constraintRule{
+			"keyword", fmt.Sprintf("mention %q", keyword), fmt.Sprintf("Mention %s explicitly!", keyword),
+			func(s string) bool { return mentionsKeyword(s, keyword) },
+		})
+	}
+	if userName = strings.TrimSpace(userName); userName != "" && slices.Contains(selected, "user") {
+		rules = append(rules, &constraintRule{
+			"user_name", fmt.Sprintf("mention %q", userName), fmt.Sprintf("Mention %s by name!", userName),
+			func(s string) bool { return mentionsName(s, userName) },
+		})
+	}
+	if name, ok := languageNames[lang]; ok {
+		rules = append(rules, &constraintRule{
+			"language", "use " + name, fmt.Sprintf("Write it in %s, and only in %s!", name, name),
+			func(s string) bool { return isLanguage(s, lang) },
+		})
+	}
+	return rules
+}
+
+// isEmoji checks if the rune is an emoji or a pictograph, including the symbols and dingbats that
+// are only presented as emoji when followed by a variation selector
+func isEmoji(r rune) bool {
+	return inRanges(emojiRanges, r) || (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) || r == 0xFE0F
+}
+
+// hasNoEmojis checks that the string has no emojis
+func hasNoEmojis(s string) bool {
+	return !strings.ContainsFunc(s, isEmoji)
+}
+
+// isNotEnglish checks if the text is written in another language than English, according to the
+// language identifier. Texts that are too short to identify are not rejected.
+func isNotEnglish(s string) bool {
+	return identifyLanguage(s) != "en"
+}
+
+// isLeetspeak checks that at least two words, or every word in a short fortune, mix letters with
+// digits or symbols that stand in for letters, like "h4ck3r"
+func isLeetspeak(s string) bool {
+	words := strings.Fields(s)
+	leet := 0
+	for _, word := range words {
+		if strings.ContainsFunc(word, unicode.IsLetter) && strings.ContainsAny(strings.Trim(word, ".,!?:;\"'()"), "0134579@$") {
+			leet++
+		}
+	}
+	return leet >= min(2, len(words))
+}
+
+// stem removes common English suffixes from a lowercase word, as long as at least three letters remain
+func stem(word string) string {
+	for _, suffix := range []string{"ies", "ing", "es", "ed", "ly", "s"} {
+		if trimmed, ok := strings.CutSuffix(word, suffix); ok && len([]rune(trimmed)) >= 3 {
+			return trimmed
+		}
+	}
+	return word
+}
+
+// mentionsKeyword checks if the keyword, or the stems of all its words, appear in the string
+func mentionsKeyword(s, keyword string) bool {
+	s, keyword = strings.ToLower(s), strings.ToLower(keyword)
+	if strings.Contains(s, keyword) {
+		return true
+	}
+	for _, word := range strings.Fields(keyword) {
+		if !strings.Contains(s, stem(word)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mentionsName checks if any part of the name, like the first name, appears in the string
+func mentionsName(s, name string) bool {
+	s = strings.ToLower(s)
+	for _, part := range strings.Fields(strings.ToLower(name)) {
+		if part = strings.Trim(part, "."); len([]rune(part)) >= 2 && strings.Contains(s, part) {
+			return true
+		}
+	}
+	return false
+}
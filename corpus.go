@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fortuneDirs are where fortune-mod installs its fortune files, on different distributions
+var fortuneDirs = []string{"/usr/share/games/fortunes", "/usr/share/fortune", "/usr/share/fortunes"}
+
+const (
+	shingleSize     = 3   // the number of words in each n-gram
+	minQuoteOverlap = 0.7 // how similar a fortune and a quote must be for the fortune to be a copy
+)
+
+// quote is an entry in a quote file, and who it is attributed to
+type quote struct {
+	text        string
+	attribution string // an empty string if the quote is not attributed to anyone
+	source      string // the name of the quote file, like "fortune-mod: computers"
+}
+
+// credit returns who the quote should be attributed to
+func (q *quote) credit() string {
+	if q.attribution != "" {
+		return q.attribution
+	}
+	return "unknown (" + q.source + ")"
+}
+
+// quoteCorpus is an index of quotes, for finding quotes that are near-verbatim copies of a fortune
+type quoteCorpus struct {
+	quotes []quote
+	sizes  []int              // the number of distinct n-grams in each quote
+	index  map[uint64][]int32 // maps n-grams onto the quotes that contain them
+}
+
+// shingles returns the distinct word n-grams of the normalized string, as hashes.
+// Strings with fewer words than shingleSize have a single n-gram.
+func shingles(s string) map[uint64]bool {
+	words := strings.Fields(normalizeQuote(s))
+	set := make(map[uint64]bool)
+	if len(words) == 0 {
+		return set
+	}
+	for i := 0; i+shingleSize <= max(len(words), shingleSize); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:min(i+shingleSize, len(words))], " ")))
+		set[h.Sum64()] = true
+	}
+	return set
+}
+
+// parseQuoteFile parses a file in the fortune-mod format, where the quotes are separated by lines with
+// a single "%". A last line that starts with "--" or "—" is taken as the attribution.
+func parseQuoteFile(data, source string) []quote {
+	var quotes []quote
+	for _, entry := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n%\n") {
+		lines := strings.Split(strings.Trim(entry, "\n%"), "\n")
+		q := quote{source: source}
+		if last := strings.TrimSpace(lines[len(lines)-1]); len(lines) > 1 && (strings.HasPrefix(last, "--") || strings.HasPrefix(last, "—")) {
+			q.attribution = strings.TrimSpace(strings.TrimLeft(last, "-— "))
+			lines = lines[:len(lines)-1]
+		}
+		if q.text = strings.TrimSpace(strings.Join(lines, "\n")); q.text != "" {
+			quotes = append(quotes, q)
+		}
+	}
+	return quotes
+}
+
+// quoteDirs returns the directories with quote files: the fortune-mod directories, and the
+// quotes directories in the configuration directories
+func quoteDirs() []string {
+	dirs := slices.Clone(fortuneDirs)
+	for _, dir := range configDirs() {
+		dirs = append(dirs, filepath.Join(dir, "quotes"))
+	}
+	return dirs
+}
+
+// loadQuoteCorpus reads and indexes all quote files in the given directories. The index files
+// from fortune-mod and subdirectories, like the one with offensive fortunes, are skipped.
+func loadQuoteCorpus(dirs []string) (*quoteCorpus, error) {
+	qc := &quoteCorpus{index: make(map[uint64][]int32)}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".dat") || strings.HasSuffix(name, ".u8") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			source := name
+			if slices.Contains(fortuneDirs, dir) {
+				source = "fortune-mod: " + name
+			}
+			for _, q := range parseQuoteFile(string(data), source) {
+				qc.add(q)
+			}
+		}
+	}
+	return qc, nil
+}
+
+// add indexes a quote
+func (qc *quoteCorpus) add(q quote) {
+	id := int32(len(qc.quotes))
+	set := shingles(q.text)
+	for h := range set {
+		qc.index[h] = append(qc.index[h], id)
+	}
+	qc.quotes = append(qc.quotes, q)
+	qc.sizes = append(qc.sizes, len(set))
+}
+
+// find returns the quote that the fortune is a near-verbatim copy of, or nil. The similarity is
+// the number of shared n-grams, relative to the average number of n-grams in the two.
+// A nil corpus has no quotes.
+func (qc *quoteCorpus) find(s string) *quote {
+	if qc == nil {
+		return nil
+	}
+	set := shingles(s)
+	if len(set) == 0 {
+		return nil
+	}
+	shared := make(map[int32]int)
+	for h := range set {
+		for _, id := range qc.index[h] {
+			shared[id]++
+		}
+	}
+	best, bestSimilarity := int32(-1), 0.0
+	for id, n := range shared {
+		if similarity := 2 * float64(n) / float64(len(set)+qc.sizes[id]); similarity > bestSimilarity {
+			best, bestSimilarity = id, similarity
+		}
+	}
+	if best < 0 || bestSimilarity < minQuoteOverlap {
+		return nil
+	}
+	return &qc.quotes[best]
+}
+
+// corpusRule rejects fortunes that are near-verbatim copies of a quote in the corpus
+type corpusRule struct {
+	corpus *quoteCorpus
+}
+
+func (cr *corpusRule) name() string { return "existing_quote" }
+
+func (cr *corpusRule) score(s string, _ bool) (float64, string) {
+	if q := cr.corpus.find(s); q != nil {
+		return 1, fmt.Sprintf("copies a quote by %s", q.credit())
+	}
+	return 0, ""
+}
+
+// hint asks the LLM for something original instead of the existing quote
+func (cr *corpusRule) hint(s string) string {
+	q := cr.corpus.find(s)
+	if q == nil {
+		return ""
+	}
+	return fmt.Sprintf("Write something original, and not the existing quote %q!", hintQuote(q.text))
+}
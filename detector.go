@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultThreshold is the total score that makes the detector reject a fortune
+const defaultThreshold = 1.0
+
+// verdict is the score that a rule gave a fortune, and the reason for it
+type verdict struct {
+	rule   string
+	score  float64
+	reason string
+	hint   string // what to add to the prompt when asking again, or an empty string
+}
+
+// rule is one named check in the rejection detector. The score is 0 if the rule has no objections
+// to the fortune, and 1 if the rule alone is enough to reject it. The reason explains the score.
+type rule interface {
+	name() string
+	score(s string, maybeInappropriate bool) (float64, string)
+}
+
+// hinter is a rule that can tell the LLM how to avoid being rejected by the rule again
+type hinter interface {
+	hint(s string) string
+}
+
+// hintQuote returns the text on one line, cut off after 60 characters, for quoting it in a hint
+func hintQuote(text string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) > 60 {
+		return string(runes[:60]) + "…"
+	}
+	return string(runes)
+}
+
+// checkRule is a rule that is implemented by a function
+type checkRule struct {
+	ruleName string
+	check    func(s string, maybeInappropriate bool) (float64, string)
+}
+
+func (cr *checkRule) name() string { return cr.ruleName }
+
+func (cr *checkRule) score(s string, maybeInappropriate bool) (float64, string) {
+	return cr.check(s, maybeInappropriate)
+}
+
+// phraseRule scores a fortune by how many of the phrases and regular expressions it contains
+type phraseRule struct {
+	ruleName          string
+	phrases           *phraseList
+	perPhrase         float64 // the score for each phrase that is found, unless the phrase has a score of its own
+	onlyInappropriate bool    // only look for the phrases when the fortune may be inappropriate
+}
+
+func (pr *phraseRule) name() string { return pr.ruleName }
+
+func (pr *phraseRule) score(s string, maybeInappropriate bool) (float64, string) {
+	if pr.onlyInappropriate && !maybeInappropriate {
+		return 0, ""
+	}
+	score, found := pr.phrases.score(s, pr.perPhrase)
+	if len(found) == 0 {
+		return 0, ""
+	}
+	return score, "contains " + strings.Join(found, ", ")
+}
+
+// blocklistRule rejects fortunes with blocked words, regardless of weights and thresholds
+type blocklistRule struct {
+	blocklist *blocklist
+}
+
+func (br *blocklistRule) name() string { return "blocklist" }
+
+func (br *blocklistRule) score(s string, _ bool) (float64, string) {
+	if found := br.blocklist.find(s); len(found) > 0 {
+		return 1, "contains the blocked " + strings.Join(found, ", ")
+	}
+	return 0, ""
+}
+
+// maxCharsRule rejects fortunes that are longer than the given number of characters
+type maxCharsRule struct {
+	maxChars int
+}
+
+func (mr *maxCharsRule) name() string { return "too_long" }
+
+func (mr *maxCharsRule) score(s string, _ bool) (float64, string) {
+	if n := len([]rune(s)); n > mr.maxChars {
+		return 1, fmt.Sprintf("%d characters is more than %d", n, mr.maxChars)
+	}
+	return 0, ""
+}
+
+// hint asks the LLM for a shorter fortune
+func (mr *maxCharsRule) hint(string) string {
+	return fmt.Sprintf("The last one was too long, so keep it shorter than %d characters!", mr.maxChars)
+}
+
+// defaultRules returns the built-in rules. Some of the phrases that probably mean that the request was
+// rejected are common in good fortunes too, so they have lower scores in the phrase file, and it takes a
+// few of them for a fortune to be rejected.
+func defaultRules(probablyRejected, rejected *phraseList, bl *blocklist, cr *clicheRule, fr *famousQuoteRule) []rule {
+	return []rule{
+		&checkRule{"too_short", func(s string, _ bool) (float64, string) {
+			if n := len([]rune(s)); n < 10 {
+				return 1, fmt.Sprintf("only %d characters long", n)
+			}
+			return 0, ""
+		}},
+		&checkRule{"odd_start", func(s string, _ bool) (float64, string) {
+			// "A" and "I" are words of their own, and not a sign of a broken fortune
+			if len(s) < 2 || strings.HasPrefix(s, "A ") || strings.HasPrefix(s, "I ") {
+				return 0, ""
+			}
+			if s[1] == ' ' || s[1] == '.' || s[1] == '-' {
+				return 1, fmt.Sprintf("starts with %q", s[:2])
+			}
+			return 0, ""
+		}},
+		&checkRule{"request_fulfill", func(s string, maybeInappropriate bool) (float64, string) {
+			if maybeInappropriate && strings.Contains(s, "request") && strings.Contains(s, "fulfill") {
+				return 1, "mentions the request and fulfilling it"
+			}
+			return 0, ""
+		}},
+		&phraseRule{ruleName: "probably_rejected", phrases: probablyRejected, perPhrase: 1, onlyInappropriate: true},
+		&checkRule{"leading_dot", func(s string, _ bool) (float64, string) {
+			if strings.HasPrefix(s, ".") {
+				return 1, "starts with a dot"
+			}
+			return 0, ""
+		}},
+		&completenessRule{},
+		&phraseRule{ruleName: "rejected", phrases: rejected, perPhrase: 1},
+		cr,
+		fr,
+		&blocklistRule{bl},
+	}
+}
+
+// detector decides if a fortune should be rejected, by adding up the weighted scores from its rules
+type detector struct {
+	rules     []rule
+	weights   map[string]float64 // the score of the named rule is multiplied with this, 0 disables the rule
+	threshold float64            // fortunes with a total score of at least this are rejected
+	blocklist *blocklist         // also used for the text that is output next to the fortune, like attributions
+}
+
+// newDetector returns a detector with the built-in rules and the default threshold. The phrases and the
+// blocklist are loaded from the configuration directories.
+func newDetector() (*detector, error) {
+	probablyRejected, err := loadPhraseList("probably_rejected.txt")
+	if err != nil {
+		return nil, err
+	}
+	rejected, err := loadPhraseList("rejected.txt")
+	if err != nil {
+		return nil, err
+	}
+	bl, err := loadBlocklist()
+	if err != nil {
+		return nil, err
+	}
+	cr, err := newClicheRule()
+	if err != nil {
+		return nil, err
+	}
+	fr, err := newFamousQuoteRule()
+	if err != nil {
+		return nil, err
+	}
+	return &detector{rules: defaultRules(probablyRejected, rejected, bl, cr, fr), weights: make(map[string]float64), threshold: defaultThreshold, blocklist: bl}, nil
+}
+
+// with returns a copy of the detector, with the given rules added. The weights are shared with the original.
+func (d *detector) with(rules ...rule) *detector {
+	return &detector{rules: append(slices.Clone(d.rules), rules...), weights: d.weights, threshold: d.threshold, blocklist: d.blocklist}
+}
+
+// ruleNames returns the names of the rules, sorted
+func (d *detector) ruleNames() []string {
+	names := make([]string, len(d.rules))
+	for i, r := range d.rules {
+		names[i] = r.name()
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setWeights parses weights like "probably_rejected" = "0.2" for the rules with the given names
+func (d *detector) setWeights(weights map[string]string) error {
+	names := d.ruleNames()
+	for name, value := range weights {
+		if name == "blocklist" {
+			return errors.New("the blocklist can not be weighted")
+		}
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("unknown rule: %s (must be %s)", name, strings.Join(names, ", "))
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight < 0 {
+			return fmt.Errorf("invalid weight for %s: %s", name, value)
+		}
+		d.weights[name] = weight
+	}
+	return nil
+}
+
+// assessment is the result of checking a fortune with all the rules of a detector
+type assessment struct {
+	fortune   string
+	total     float64
+	threshold float64
+	blocked   bool      // true if the fortune contains a blocked word
+	verdicts  []verdict // the rules that had objections, with the highest score first
+}
+
+// assess checks the fortune with all the rules
+func (d *detector) assess(s string, maybeInappropriate bool) *assessment {
+	a := &assessment{fortune: s, threshold: d.threshold}
+	for _, r := range d.rules {
+		score, reason := r.score(s, maybeInappropriate)
+		if _, ok := r.(*blocklistRule); ok && score > 0 {
+			a.blocked = true
+		} else if weight, ok := d.weights[r.name()]; ok {
+			score *= weight
+		}
+		if score > 0 {
+			v := verdict{rule: r.name(), score: score, reason: reason}
+			if h, ok := r.(hinter); ok {
+				v.hint = h.hint(s)
+			}
+			a.verdicts = append(a.verdicts, v)
+			a.total += score
+		}
+	}
+	sort.SliceStable(a.verdicts, func(i, j int) bool { return a.verdicts[i].score > a.verdicts[j].score })
+	return a
+}
+
+// rejected checks if the total score is high enough for the fortune to be rejected
+func (a *assessment) rejected() bool {
+	return a.blocked || (len(a.verdicts) > 0 && a.total >= a.threshold)
+}
+
+// rule returns the name of the rule that contributed the most to a rejection, or an empty string
+func (a *assessment) rule() string {
+	switch {
+	case a.blocked:
+		return "blocklist"
+	case !a.rejected():
+		return ""
+	}
+	return a.verdicts[0].rule
+}
+
+// explain writes the total score and the verdicts of the rules that had objections
+func (a *assessment) explain(w io.Writer) {
+	outcome := "accepted"
+	if a.rejected() {
+		outcome = "rejected"
+	}
+	fmt.Fprintf(w, "%s (score %.2f, threshold %.2f): %q\n", outcome, a.total, a.threshold, a.fortune)
+	for _, v := range a.verdicts {
+		fmt.Fprintf(w, "  %-18s %.2f  %s\n", v.rule, v.score, v.reason)
+	}
+}
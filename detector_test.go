@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestProbablyRejected(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	d, err := newDetector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		s        string
+		rejected bool
+	}{
+		{"As an AI assistant, I can't write something like that.", true},
+		{"I cannot provide content like that.", true},
+		{"Let us keep the conversation fun and safe.", true},
+		{"Here is a disclaimer: no jokes were harmed.", true},
+		{"Content is king, but context is the kingdom.", false},
+		{"Offensive coordinators hate this one appropriate trick.", false},
+	}
+	for _, tt := range tests {
+		if got := d.assess(tt.s, true).rejected(); got != tt.rejected {
+			t.Errorf("assess(%q).rejected() = %v, want %v", tt.s, got, tt.rejected)
+		}
+	}
+}
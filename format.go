@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xyproto/env/v2"
+	"golang.org/x/term"
+)
+
+// getTerminalWidth tries to find the current width of the terminal, with a fallback on 120
+func getTerminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		// Check if the COLS env var is set
+		return env.Int("COLS", 120)
+	}
+	return width
+}
+
+// isTerminal checks if stdout is a terminal
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// wrapFortune wraps the generated fortune so that it fits within 95% of the given width
+func wrapFortune(s string, terminalWidth int) string {
+	if terminalWidth <= 0 {
+		return strings.TrimSpace(strings.TrimPrefix(s, "."))
+	}
+	maxWidth := int(float64(terminalWidth) * 0.95)
+	marginRight := int(float64(terminalWidth) * 0.05)
+	return strings.Join(wrapLines(s, maxWidth, marginRight), "\n")
+}
+
+// wrapLines wraps the generated fortune so that each line fits within maxWidth cells.
+// If the last of two lines is shorter than marginRight, the two lines are joined.
+func wrapLines(s string, maxWidth, marginRight int) []string {
+	s = strings.TrimSpace(strings.TrimPrefix(s, "."))
+	if maxWidth <= 0 {
+		return []string{s}
+	}
+	lines, err := poeticWrap(strings.ReplaceAll(s, "  ", " "), maxWidth, 0)
+	if err != nil || len(lines) == 0 {
+		return []string{s}
+	}
+	if len(lines) == 2 && displayWidth(lines[1]) < marginRight {
+		last, _ := utf8.DecodeLastRuneInString(lines[0])
+		first, _ := utf8.DecodeRuneInString(lines[1])
+		if isBreakable(last) || isBreakable(first) {
+			lines[0] += lines[1] // no space between Chinese and Japanese characters
+		} else {
+			lines[0] += " " + lines[1]
+		}
+	}
+	return lines
+}
+
+// layout describes how a fortune is placed in the terminal
+type layout struct {
+	width       int    // the width to lay out the fortune for, or 0 for 95% of the terminal width
+	indent      int    // spaces before each line
+	center      bool   // center each line within the width
+	justify     bool   // stretch all lines but the last one to the full width
+	wrap        bool   // wrap long lines
+	frame       string // the name of a frame style to draw a box with, or an empty string
+	bubble      bool   // place the fortune in a speech bubble
+	art         string // the name of the ASCII art below the speech bubble, or an empty string
+	attribution string // who the fortune is attributed to, or an empty string
+	theme       *theme // the colors to use, or nil
+}
+
+// justifyLine stretches a line to the given width by widening the spaces between words
+func justifyLine(line string, width int) string {
+	words := strings.Fields(line)
+	gaps := len(words) - 1
+	if gaps <= 0 {
+		return line
+	}
+	extra := width - displayWidth(strings.Join(words, " "))
+	if extra <= 0 {
+		return line
+	}
+	var sb strings.Builder
+	for i, word := range words {
+		sb.WriteString(word)
+		if i < gaps {
+			spaces := 1 + extra/gaps
+			if i < extra%gaps {
+				spaces++
+			}
+			sb.WriteString(strings.Repeat(" ", spaces))
+		}
+	}
+	return sb.String()
+}
+
+// format wraps the generated fortune for terminal display using the poetic
+// line-breaking algorithm, which prefers natural punctuation boundaries over
+// arbitrary word boundaries and measures text in terminal cells, and then
+// aligns the lines according to the layout.
+func (l *layout) format(s string) string {
+	width := l.width
+	maxWidth := width - l.indent
+	marginRight := 0 // a given width is a hard limit, so never join lines past it
+	if width <= 0 {
+		width = getTerminalWidth()
+		maxWidth = int(float64(width)*0.95) - l.indent
+		marginRight = width * 5 / 100
+	}
+	boxed := l.frame != "" || l.bubble
+	if boxed {
+		maxWidth -= 4 // room for the borders and the spaces next to them
+	}
+	var lines []string
+	if l.wrap {
+		lines = wrapLines(s, maxWidth, marginRight)
+	} else {
+		lines = strings.Split(strings.TrimSpace(strings.TrimPrefix(s, ".")), "\n")
+	}
+	if l.justify && l.wrap {
+		for i := 0; i < len(lines)-1; i++ {
+			lines[i] = justifyLine(lines[i], maxWidth)
+		}
+	}
+	if l.bubble {
+		lines = bubbleLines(lines, arts[l.art], l.theme)
+	} else if bc, ok := frames[l.frame]; ok {
+		lines = frameLines(lines, bc, l.theme)
+	} else {
+		for i, line := range lines {
+			lines[i] = l.theme.text(line)
+		}
+	}
+	// the attribution is placed on its own line, aligned to the right edge of the fortune
+	blockWidth := maxDisplayWidth(lines)
+	if l.attribution != "" {
+		attribution := "— " + l.attribution
+		lines = append(lines, l.theme.dim(strings.Repeat(" ", max(blockWidth-displayWidth(attribution), 0))+attribution))
+	}
+	// a speech bubble or a box is centered as a whole, while text is centered line by line
+	for i, line := range lines {
+		if l.center {
+			if !boxed {
+				blockWidth = displayWidth(line)
+			}
+			if padding := (width - l.indent - blockWidth) / 2; padding > 0 {
+				line = strings.Repeat(" ", padding) + line
+			}
+		}
+		if l.indent > 0 {
+			line = strings.Repeat(" ", l.indent) + line
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/ollamaclient/v2"
+	"github.com/xyproto/usermodel"
+)
+
+// maxRetries is how many times the LLM is asked again before giving up
+const maxRetries = 7
+
+// errNoFortune is returned when the LLM only came up with rejections or broken fortunes
+var errNoFortune = errors.New("could not generate a fortune that was not rejected")
+
+// basePrompt is the start of every prompt, the selected styles are appended to it
+const basePrompt = "Write a clever saying, quote or joke that could have come from the fortune-mod application on Linux. Only output the fortune, in plain text."
+
+// trim tries to remove quotes, stars and spaces that are not needed
+func trim(generatedOutput string) string {
+	// TODO: Use one large regex?
+	trimmed := strings.TrimSpace(ollamaclient.Massage(stripControls(generatedOutput)))
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "```"), "```")
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "`"), "`")
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "'"), "'")
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "\u2018"), "\u2019")
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "\""), "\"")
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "\u201C"), "\u201D")
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "**"), "**")
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "*"), "*")
+	trimmed = strings.TrimPrefix(trimmed, ".")
+	trimmed = strings.ReplaceAll(trimmed, "*", "")
+	return strings.ReplaceAll(strings.TrimSpace(trimmed), "  ", " ")
+}
+
+// newClient prepares an Ollama client for the text generation model, and pulls the model if needed.
+// Progress bars are only shown while pulling if verbose is true.
+func newClient(verbose bool) (*ollamaclient.Config, error) {
+	// Respect OLLAMA_MODEL if set, otherwise fall back to the usermodel default
+	oc, err := newClientForModel(env.Str("OLLAMA_MODEL", usermodel.GetTextGenerationModel()), verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	oc.SetRandom()
+
+	return oc, nil
+}
+
+// newClientForModel prepares an Ollama client for the given model, and pulls the model if needed
+func newClientForModel(model string, verbose bool) (*ollamaclient.Config, error) {
+	oc := ollamaclient.New()
+	oc.ModelName = model
+
+	if err := oc.PullIfNeeded(verbose); err != nil {
+		return nil, fmt.Errorf("failed to pull model: %w\nOllama must be up and running", err)
+	}
+
+	found, err := oc.Has(oc.ModelName)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for model: %w", err)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("expected to have the '%s' model downloaded, but it's not present", oc.ModelName)
+	}
+
+	return oc, nil
+}
+
+// newLowTemperatureClient prepares an Ollama client for the given model, for tasks like translating and judging.
+// The temperature is low for answers that stay close to the task, but not 0, so that a bad answer is not repeated.
+func newLowTemperatureClient(model string, verbose bool) (*ollamaclient.Config, error) {
+	oc, err := newClientForModel(model, verbose)
+	if err != nil {
+		return nil, err
+	}
+	oc.SetRandom()
+	oc.TemperatureIfNegativeSeed = 0.2
+	return oc, nil
+}
+
+// ask sends the prompt to the LLM and returns the completion, with the trimmed output.
+// If tw is not nil, the output is streamed to it while it is being generated.
+// The tokens per second, as reported by Ollama, are recorded in the metrics.
+func ask(oc *ollamaclient.Config, prompt string, tw *typewriter) (*completion, error) {
+	observeGenerate()
+	generateResults.reset()
+	var output string
+	if tw != nil {
+		var sb strings.Builder
+		err := oc.StreamOutput(func(token string, done bool) {
+			if done {
+				return
+			}
+			sb.WriteString(token)
+			tw.write(token)
+		}, prompt)
+		if err != nil {
+			return nil, err
+		}
+		output = sb.String()
+	} else {
+		resp, err := oc.GetResponse(prompt)
+		if err != nil {
+			return nil, err
+		}
+		output = resp.Response
+	}
+	c := &completion{text: trim(output)}
+	if result := generateResults.latest(); result != nil {
+		c.tokens, c.doneReason = result.EvalCount, result.DoneReason
+		fortuneMetrics.observeTokens(result.EvalCount, time.Duration(result.EvalDuration))
+	}
+	return c, nil
+}
+
+// generation is a generated fortune, together with information about how it was generated
+type generation struct {
+	text        string
+	retries     int
+	rejections  []string // the names of the rules that rejected earlier candidates
+	attribution string   // who the fortune is attributed to, if an attribution was asked for
+	translation string   // the fortune translated to another language, if a translation was asked for
+	duration    time.Duration
+}
+
+// fortuneOptions are constraints on the generated fortune, and how it is output while it is generated
+type fortuneOptions struct {
+	oneline  bool        // join the lines of the fortune into a single line
+	maxChars int         // the longest fortune that is accepted, in characters, or 0 for no limit
+	stream   *typewriter // stream the output to this typewriter, or nil
+	detector *detector   // the detector for rejected fortunes, or nil for the built-in rules
+	rules    []rule      // rules in addition to the ones in the detector, like the constraints of the styles
+	explain  io.Writer   // explain why each fortune was accepted or rejected, or nil
+}
+
+// ask asks the LLM for a fortune, and joins the lines if a single line is wanted.
+// If the LLM was cut off before it was done, it is asked once to finish the fortune.
+func (o *fortuneOptions) ask(oc *ollamaclient.Config, prompt string) (string, error) {
+	c, err := ask(oc, prompt, o.stream)
+	if err != nil {
+		return "", err
+	}
+	if c.truncated() {
+		if o.explain != nil {
+			fmt.Fprintf(o.explain, "cut off after %d tokens, asking for the rest: %q\n", c.tokens, c.text)
+		}
+		if o.stream != nil {
+			o.stream.erase()
+		}
+		fortuneMetrics.countFallback("finish")
+		if c, err = ask(oc, fmt.Sprintf(finishPrompt, c.text), o.stream); err != nil {
+			return "", err
+		}
+	}
+	if !o.oneline {
+		return c.text, nil
+	}
+	return strings.Join(strings.Fields(c.text), " "), nil
+}
+
+// assess checks the fortune with the detector, and explains the result if asked to
+func (o *fortuneOptions) assess(d *detector, s string, maybeInappropriate bool) *assessment {
+	a := d.assess(s, maybeInappropriate)
+	if o.explain != nil {
+		a.explain(o.explain)
+	}
+	return a
+}
+
+// allows checks if a text and an attribution that were not generated, like an existing quote that replaces
+// the fortune, may still be output. The text must fit within the length limit, and neither may have words
+// from the blocklist of the detector.
+func (o *fortuneOptions) allows(text, attribution string) bool {
+	if o.maxChars > 0 {
+		if score, _ := (&maxCharsRule{o.maxChars}).score(text, false); score > 0 {
+			return false
+		}
+	}
+	return len(o.detector.blocklist.find(text)) == 0 && len(o.detector.blocklist.find(attribution)) == 0
+}
+
+// generateFortune asks the LLM for a fortune until it gets one that does not look like a rejection,
+// with the given constraints and output options. errNoFortune is returned if it has been tried too many times.
+// When streaming, rejected output is erased before asking again, while the accepted output is left for
+// the caller to erase. Fortunes that are too long are not truncated, but the LLM is asked for a shorter one.
+func generateFortune(oc *ollamaclient.Config, prompt string, maybeInappropriate bool, o *fortuneOptions) (*generation, error) {
+	start := time.Now()
+	trimmed, err := o.ask(oc, prompt)
+	if err != nil {
+		return nil, err
+	}
+	retryCounter := 0
+	inappropriate := maybeInappropriate
+	g := &generation{}
+
+	d := o.detector
+	if d == nil {
+		if d, err = newDetector(); err != nil {
+			return nil, err
+		}
+	}
+	d = d.with(o.rules...)
+	if o.maxChars > 0 {
+		d = d.with(&maxCharsRule{o.maxChars})
+	}
+
+	for a := o.assess(d, trimmed, maybeInappropriate); a.rejected(); a = o.assess(d, trimmed, maybeInappropriate) {
+		rule := a.rule()
+		fortuneMetrics.countRefusal(rule)
+		g.rejections = append(g.rejections, rule)
+		if o.stream != nil {
+			o.stream.erase()
+		}
+		// tell the LLM how to avoid being rejected again, but only once for each hint
+		for _, v := range a.verdicts {
+			if v.hint != "" && !strings.Contains(prompt, v.hint) {
+				prompt += " " + v.hint
+			}
+		}
+		trimmed, err = o.ask(oc, prompt)
+		if err != nil {
+			return nil, err
+		}
+		retryCounter++
+		g.retries++
+		fortuneMetrics.countRetry()
+		if retryCounter > maxRetries && !inappropriate { // Tried too many times
+			fortuneMetrics.countFallback("nothing")
+			return nil, errNoFortune
+		} else if retryCounter > maxRetries && inappropriate {
+			fortuneMetrics.countFallback("milder_prompt")
+			prompt = strings.Replace(prompt, "wildly and extremely inappropriate", "mildly inappropriate", 1)
+			inappropriate = false
+			retryCounter -= 3 // Try 3 more times now that the output may be less inappropriate
+			continue
+		}
+	}
+
+	g.text = trimmed
+	g.duration = time.Since(start)
+	fortuneMetrics.countGenerated(g.duration)
+	return g, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// boxChars are the characters used for drawing a frame: top left, horizontal, top right,
+// vertical, bottom left and bottom right
+type boxChars [6]string
+
+// frames are the available frame styles for --frame
+var frames = map[string]boxChars{
+	"ascii":   {"+", "-", "+", "|", "+", "+"},
+	"double":  {"╔", "═", "╗", "║", "╚", "╝"},
+	"heavy":   {"┏", "━", "┓", "┃", "┗", "┛"},
+	"rounded": {"╭", "─", "╮", "│", "╰", "╯"},
+	"single":  {"┌", "─", "┐", "│", "└", "┘"},
+}
+
+// frameNames returns the names of the available frame styles, sorted
+func frameNames() []string {
+	names := make([]string, 0, len(frames))
+	for name := range frames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// arts are the ASCII art characters that can say the fortune in a speech bubble
+var arts = map[string]string{
+	"borg": `     \     ________
+      \   /       /|
+       \ /_______/ |
+         |       | |
+         | BORG  | /
+         |_______|/`,
+	"cat": `     \
+      \    /\_/\
+       \  ( o.o )
+           > ^ <`,
+	"cow": `        \   ^__^
+         \  (oo)\_______
+            (__)\       )\/\
+                ||----w |
+                ||     ||`,
+	"dog": `     \
+      \   / \__
+       \ (    @\___
+         /         O
+        /   (_____/
+       /_____/   U`,
+	"pirate": `     \      _____
+      \    /     \
+       \  | () () |
+           \  ^  /
+            |||||
+            |||||`,
+	"pony": `     \      _
+      \    / )_
+       \  /    '.
+         /  _   o\
+        (  / '---'
+         \ \
+          ) )`,
+	"robot": `     \    _____
+      \  | o o |
+       \ |  ^  |
+         |_===_|
+         /|   |\
+          d   b`,
+}
+
+// styleArts maps style names onto the art that is picked for --art auto, in order of preference
+var styleArts = []struct{ style, art string }{
+	{"borg", "borg"},
+	{"cats", "cat"},
+	{"dogs", "dog"},
+	{"pirate", "pirate"},
+	{"pony", "pony"},
+	{"robot", "robot"},
+}
+
+// artNames returns the names of the available arts, sorted
+func artNames() []string {
+	names := make([]string, 0, len(arts))
+	for name := range arts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pickArt returns the name of the art that fits the selected styles best, or "cow"
+func pickArt(selected []string) string {
+	for _, sa := range styleArts {
+		if slices.Contains(selected, sa.style) {
+			return sa.art
+		}
+	}
+	return "cow"
+}
+
+// maxDisplayWidth returns the display width of the widest line
+func maxDisplayWidth(lines []string) int {
+	widest := 0
+	for _, line := range lines {
+		widest = max(widest, displayWidth(line))
+	}
+	return widest
+}
+
+// padRight pads the line with spaces until it is the given number of cells wide
+func padRight(line string, width int) string {
+	if w := displayWidth(line); w < width {
+		return line + strings.Repeat(" ", width-w)
+	}
+	return line
+}
+
+// frameLines draws a box around the lines, using the given box characters.
+// The theme is used for coloring the lines and the box.
+func frameLines(lines []string, bc boxChars, th *theme) []string {
+	width := maxDisplayWidth(lines)
+	framed := make([]string, 0, len(lines)+2)
+	framed = append(framed, th.dim(bc[0]+strings.Repeat(bc[1], width+2)+bc[2]))
+	for _, line := range lines {
+		framed = append(framed, th.dim(bc[3])+" "+th.text(padRight(line, width))+" "+th.dim(bc[3]))
+	}
+	return append(framed, th.dim(bc[4]+strings.Repeat(bc[1], width+2)+bc[5]))
+}
+
+// bubbleLines draws a speech bubble around the lines, like cowsay does,
+// and places the given ASCII art below it. The theme is used for coloring.
+func bubbleLines(lines []string, art string, th *theme) []string {
+	width := maxDisplayWidth(lines)
+	bubble := make([]string, 0, len(lines)+2)
+	bubble = append(bubble, th.dim(" "+strings.Repeat("_", width+2)))
+	for i, line := range lines {
+		left, right := "|", "|"
+		switch {
+		case len(lines) == 1:
+			left, right = "<", ">"
+		case i == 0:
+			left, right = "/", "\\"
+		case i == len(lines)-1:
+			left, right = "\\", "/"
+		}
+		bubble = append(bubble, th.dim(left)+" "+th.text(padRight(line, width))+" "+th.dim(right))
+	}
+	bubble = append(bubble, th.dim(" "+strings.Repeat("-", width+2)))
+	if art != "" {
+		for _, artLine := range strings.Split(art, "\n") {
+			bubble = append(bubble, th.dim(artLine))
+		}
+	}
+	return bubble
+}
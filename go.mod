@@ -9,6 +9,7 @@ require (
 	github.com/xyproto/ollamaclient/v2 v2.8.1
 	github.com/xyproto/usermodel v1.3.0
 	github.com/xyproto/wordwrap v1.2.0
+	golang.org/x/image v0.44.0
 	golang.org/x/term v0.44.0
 )
 
@@ -18,4 +19,5 @@ require (
 	github.com/xyproto/binary v1.4.0 // indirect
 	github.com/xyproto/files v1.10.8 // indirect
 	golang.org/x/sys v0.46.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
 )
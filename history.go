@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/ollamaclient/v2"
+)
+
+const (
+	defaultEmbeddingModel  = "nomic-embed-text"
+	defaultRepeatThreshold = 0.9 // the cosine similarity that makes a fortune a repeat of an earlier one
+	maxHistory             = 200 // the number of recent fortunes that are kept in the history file
+)
+
+// defaultHistoryFile returns where the embeddings of recent fortunes are stored by default
+func defaultHistoryFile() string {
+	stateDir := env.Dir("XDG_STATE_HOME", filepath.Join(env.HomeDir(), ".local", "state"))
+	return filepath.Join(stateDir, "fortunecraft", "history.json")
+}
+
+// historyEntry is an accepted fortune, and its embedding
+type historyEntry struct {
+	Fortune   string    `json:"fortune"`
+	Model     string    `json:"model"` // the embedding model, since embeddings from different models can not be compared
+	Embedding []float64 `json:"embedding"`
+	Time      time.Time `json:"time"`
+}
+
+// history is a local vector store with the embeddings of the most recent fortunes
+type history struct {
+	filename string
+	entries  []historyEntry
+}
+
+// loadHistory reads the history file. A file that does not exist is an empty history.
+func loadHistory(filename string) (*history, error) {
+	h := &history{filename: filename}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &h.entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return h, nil
+}
+
+// add adds an entry to the history, and forgets the oldest entries if there are too many
+func (h *history) add(e historyEntry) {
+	h.entries = append(h.entries, e)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+}
+
+// save writes the history file, and creates the directory if needed
+func (h *history) save() error {
+	data, err := json.Marshal(h.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.filename), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomically(h.filename, data)
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors, or 0 if they can not be compared
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// mostSimilar returns the entry with an embedding from the given model that is the most similar to
+// the given embedding, and the similarity. The entry is nil if there are no entries for the model.
+func (h *history) mostSimilar(model string, embedding []float64) (*historyEntry, float64) {
+	var (
+		best           *historyEntry
+		bestSimilarity float64
+	)
+	for i := range h.entries {
+		if e := &h.entries[i]; e.Model == model {
+			if similarity := cosineSimilarity(e.Embedding, embedding); best == nil || similarity > bestSimilarity {
+				best, bestSimilarity = e, similarity
+			}
+		}
+	}
+	return best, bestSimilarity
+}
+
+// repeatRule rejects fortunes that are paraphrases of recent fortunes, by comparing their embeddings
+type repeatRule struct {
+	oc         *ollamaclient.Config
+	history    *history
+	threshold  float64
+	embeddings map[string][]float64 // the embeddings of the checked fortunes, so that each fortune is only embedded once
+}
+
+// newRepeatRule prepares a repeat rule that uses the given embedding model and history file
+func newRepeatRule(model, filename string, threshold float64, verbose bool) (*repeatRule, error) {
+	oc, err := newClientForModel(model, verbose)
+	if err != nil {
+		return nil, err
+	}
+	h, err := loadHistory(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &repeatRule{oc: oc, history: h, threshold: threshold, embeddings: make(map[string][]float64)}, nil
+}
+
+// embed returns the embedding of the fortune
+func (rr *repeatRule) embed(s string) ([]float64, error) {
+	if embedding, ok := rr.embeddings[s]; ok {
+		return embedding, nil
+	}
+	embedding, err := rr.oc.Embeddings(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedding) == 0 {
+		return nil, errors.New("got an empty embedding")
+	}
+	rr.embeddings[s] = embedding
+	return embedding, nil
+}
+
+// repeated returns the earlier fortune that the fortune repeats, and the similarity, or nil
+func (rr *repeatRule) repeated(s string) (*historyEntry, float64) {
+	embedding, err := rr.embed(s)
+	if err != nil {
+		return nil, 0
+	}
+	if e, similarity := rr.history.mostSimilar(rr.oc.ModelName, embedding); e != nil && similarity >= rr.threshold {
+		return e, similarity
+	}
+	return nil, 0
+}
+
+func (rr *repeatRule) name() string { return "repeat" }
+
+// score does not reject the fortune if it could not be embedded, since the other rules still apply
+func (rr *repeatRule) score(s string, _ bool) (float64, string) {
+	if e, similarity := rr.repeated(s); e != nil {
+		return 1, fmt.Sprintf("is %.0f%% similar to %q", similarity*100, e.Fortune)
+	}
+	return 0, ""
+}
+
+// hint asks the LLM for something different from the earlier fortune
+func (rr *repeatRule) hint(s string) string {
+	e, _ := rr.repeated(s)
+	if e == nil {
+		return ""
+	}
+	return fmt.Sprintf("Write something completely different from %q!", strings.TrimRight(hintQuote(e.Fortune), ".!?"))
+}
+
+// remember adds the accepted fortune to the history, and saves the history file
+func (rr *repeatRule) remember(s string) error {
+	embedding, err := rr.embed(s)
+	if err != nil {
+		return err
+	}
+	rr.history.add(historyEntry{Fortune: s, Model: rr.oc.ModelName, Embedding: embedding, Time: time.Now().UTC()})
+	return rr.history.save()
+}
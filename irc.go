@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/pflag"
+	"github.com/xyproto/ollamaclient/v2"
+)
+
+const (
+	// ircMaxLineLength is the most bytes in an IRC message, including the trailing CR LF
+	ircMaxLineLength = 512
+
+	// ircPrefixLength is room for the ":nick!user@host " prefix that the server adds when
+	// relaying a message to the channel, which counts towards the 512 byte limit
+	ircPrefixLength = 100
+
+	// maxKeywordLength is the maximum number of runes in a keyword given in a channel
+	maxKeywordLength = 40
+
+	// reconnectDelay is how long to wait before connecting again, after losing the connection
+	reconnectDelay = 30 * time.Second
+)
+
+// styleAliases maps command words that are not style names onto style names
+var styleAliases = map[string]string{
+	"1337":      "leet",
+	"cat":       "cats",
+	"computers": "computer",
+	"dog":       "dogs",
+	"gen-z":     "genz",
+	"me":        "user",
+	"ninjas":    "ninja",
+	"ponies":    "pony",
+	"robots":    "robot",
+	"sci-fi":    "scifi",
+}
+
+// ircMessage is a parsed IRC protocol message
+type ircMessage struct {
+	prefix  string
+	command string
+	params  []string
+}
+
+// nick returns the nickname part of the message prefix
+func (m *ircMessage) nick() string {
+	nick, _, _ := strings.Cut(m.prefix, "!")
+	return nick
+}
+
+// parseIRCMessage parses a line like ":nick!user@host PRIVMSG #channel :hello there"
+func parseIRCMessage(line string) *ircMessage {
+	line = strings.TrimRight(line, "\r\n")
+	m := &ircMessage{}
+	if strings.HasPrefix(line, ":") {
+		m.prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			m.params = append(m.params, line[1:])
+			break
+		}
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		if param == "" {
+			continue
+		}
+		if m.command == "" {
+			m.command = strings.ToUpper(param)
+		} else {
+			m.params = append(m.params, param)
+		}
+	}
+	return m
+}
+
+// sanitizeKeyword only keeps letters, digits, spaces, hyphens and apostrophes from the given
+// keyword, and limits the length, so that the keyword can not be used to rewrite the prompt
+func sanitizeKeyword(keyword string) string {
+	var sb strings.Builder
+	for _, r := range keyword {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '\'':
+			sb.WriteRune(r)
+		case unicode.IsSpace(r):
+			sb.WriteRune(' ')
+		}
+	}
+	runes := []rune(strings.Join(strings.Fields(sb.String()), " "))
+	if len(runes) > maxKeywordLength {
+		runes = runes[:maxKeywordLength]
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// parseFortuneCommand maps the words after "!fortune" onto style names.
+// Words that are not styles are used as the keyword.
+func parseFortuneCommand(words []string) (selected []string, keyword string) {
+	var keywords []string
+	for _, word := range words {
+		name := strings.TrimLeft(strings.ToLower(word), "-")
+		if alias, ok := styleAliases[name]; ok {
+			name = alias
+		}
+		if isStyle(name) {
+			selected = append(selected, name)
+		} else {
+			keywords = append(keywords, word)
+		}
+	}
+	return selected, sanitizeKeyword(strings.Join(keywords, " "))
+}
+
+// isStyle checks if the given name is the name of one of the styles
+func isStyle(name string) bool {
+	return slices.ContainsFunc(styles, func(s style) bool { return s.name == name })
+}
+
+// ircBot answers !fortune commands in IRC channels
+type ircBot struct {
+	oc        *ollamaclient.Config
+	nick      string
+	channels  []string
+	password  string
+	rateLimit time.Duration
+
+	conn      net.Conn
+	writeMut  sync.Mutex
+	generate  sync.Mutex // only one fortune is generated at the time
+	lastMut   sync.Mutex
+	lastAsked map[string]time.Time
+}
+
+// send writes one line to the IRC server
+func (bot *ircBot) send(format string, args ...any) error {
+	bot.writeMut.Lock()
+	defer bot.writeMut.Unlock()
+	_, err := fmt.Fprintf(bot.conn, format+"\r\n", args...)
+	return err
+}
+
+// allowed checks if the given nick may ask for a new fortune now, and if not, how long to wait
+func (bot *ircBot) allowed(nick string) (bool, time.Duration) {
+	bot.lastMut.Lock()
+	defer bot.lastMut.Unlock()
+	now := time.Now()
+	if last, ok := bot.lastAsked[nick]; ok && now.Sub(last) < bot.rateLimit {
+		return false, bot.rateLimit - now.Sub(last)
+	}
+	bot.lastAsked[nick] = now
+	return true, 0
+}
+
+// splitBytes splits a line into parts of at most maxBytes bytes, at spaces if possible,
+// and never in the middle of a UTF-8 encoded rune
+func splitBytes(line string, maxBytes int) []string {
+	var parts []string
+	for len(line) > maxBytes {
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if space := strings.LastIndexByte(line[:cut], ' '); space > 0 {
+			cut = space
+		}
+		if cut == 0 { // maxBytes is smaller than the first rune
+			cut = len(line)
+		}
+		parts = append(parts, strings.TrimSpace(line[:cut]))
+		line = strings.TrimSpace(line[cut:])
+	}
+	if line != "" {
+		parts = append(parts, line)
+	}
+	return parts
+}
+
+// reply sends a fortune or a message to a channel or to a user, one line at the time. Control characters
+// are removed, and long lines are split so that each message fits within the byte limit of IRC.
+func (bot *ircBot) reply(target, text string) {
+	maxBytes := ircMaxLineLength - ircPrefixLength - len("PRIVMSG  :\r\n") - len(target)
+	for _, line := range strings.Split(stripControls(text), "\n") {
+		for _, part := range splitBytes(strings.TrimSpace(line), maxBytes) {
+			if err := bot.send("PRIVMSG %s :%s", target, part); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleFortune generates a fortune for the given words and sends it to target
+func (bot *ircBot) handleFortune(target, nick string, words []string) {
+	if ok, wait := bot.allowed(nick); !ok {
+		bot.send("NOTICE %s :Please wait %d seconds before asking for another fortune.", nick, int(wait.Seconds())+1)
+		return
+	}
+	if len(words) == 1 && strings.EqualFold(words[0], "help") {
+		var names []string
+		for _, s := range styles {
+			names = append(names, s.name)
+		}
+		bot.send("NOTICE %s :Usage: !fortune [styles] [keyword]. Styles: %s", nick, strings.Join(names, " "))
+		return
+	}
+	selected, keyword := parseFortuneCommand(words)
+
+	bot.generate.Lock()
+	opts := &fortuneOptions{rules: constraintRules(selected, keyword, nick, "")}
+	fortune, err := generateFortune(bot.oc, buildPrompt(selected, keyword, nick, ""), slices.Contains(selected, "inappropriate"), opts)
+	bot.generate.Unlock()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not generate a fortune for %s: %v\n", nick, err)
+		bot.reply(target, "I've got nothing.")
+		return
+	}
+	bot.reply(target, fortune.text)
+}
+
+// handle deals with one message from the IRC server
+func (bot *ircBot) handle(m *ircMessage) {
+	switch m.command {
+	case "PING":
+		bot.send("PONG :%s", strings.Join(m.params, " "))
+	case "001": // welcome, registration is done
+		for _, channel := range bot.channels {
+			bot.send("JOIN %s", channel)
+		}
+	case "433": // nick already in use
+		bot.nick += "_"
+		bot.send("NICK %s", bot.nick)
+	case "PRIVMSG":
+		if len(m.params) < 2 {
+			return
+		}
+		words := strings.Fields(m.params[1])
+		if len(words) == 0 || !strings.EqualFold(words[0], "!fortune") {
+			return
+		}
+		target := m.params[0]
+		if strings.EqualFold(target, bot.nick) { // a private message
+			target = m.nick()
+		}
+		go bot.handleFortune(target, m.nick(), words[1:])
+	}
+}
+
+// run connects to the given IRC server and handles messages until the connection is lost
+func (bot *ircBot) run(server string, useTLS bool) error {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if useTLS {
+		conn, err = tls.Dial("tcp", server, nil)
+	} else {
+		conn, err = net.Dial("tcp", server)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	bot.writeMut.Lock()
+	bot.conn = conn
+	bot.writeMut.Unlock()
+
+	if bot.password != "" {
+		bot.send("PASS %s", bot.password)
+	}
+	bot.send("NICK %s", bot.nick)
+	bot.send("USER %s 0 * :%s", bot.nick, versionString)
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		bot.handle(parseIRCMessage(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// ircMain handles "fortunecraft irc", which runs an IRC bot that answers !fortune commands
+func ircMain(args []string) {
+	fs := pflag.NewFlagSet("irc", pflag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\n", versionString)
+		fmt.Fprintln(os.Stderr, "Run an IRC bot that answers \"!fortune [styles] [keyword]\" commands.")
+		fmt.Fprintf(os.Stderr, "\nUsage:\n  fortunecraft irc [flags]\n\n")
+		fmt.Fprintln(os.Stderr, "Available Flags:")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nExamples:")
+		fmt.Fprintln(os.Stderr, "  fortunecraft irc --server irc.example.org:6697 --tls --channels '#team,#random'")
+		fmt.Fprintln(os.Stderr, "  fortunecraft irc --channels '#team' --listen :9090")
+		fmt.Fprintln(os.Stderr, "\nIn a channel:")
+		fmt.Fprintln(os.Stderr, "  !fortune evil pirate")
+		fmt.Fprintln(os.Stderr, "  !fortune ironic AI")
+	}
+	serverFlag := fs.String("server", "localhost:6667", "The IRC server to connect to, as host:port")
+	tlsFlag := fs.Bool("tls", false, "Connect to the IRC server with TLS")
+	nickFlag := fs.String("nick", "fortunecraft", "The nickname of the bot")
+	channelsFlag := fs.StringSlice("channels", []string{"#fortunecraft"}, "Comma separated list of channels to join")
+	passwordFlag := fs.String("password", "", "The IRC server password, if needed")
+	rateLimitFlag := fs.Duration("rate-limit", 30*time.Second, "How long each user must wait between fortunes")
+	listenFlag := fs.String("listen", "", "Serve /metrics, /healthz and /readyz on this address, like :9090")
+
+	fs.Parse(args)
+
+	oc, err := newClient(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *listenFlag != "" {
+		startStatusServer(*listenFlag, oc)
+	}
+
+	bot := &ircBot{
+		oc:        oc,
+		nick:      *nickFlag,
+		channels:  *channelsFlag,
+		password:  *passwordFlag,
+		rateLimit: *rateLimitFlag,
+		lastAsked: make(map[string]time.Time),
+	}
+
+	for {
+		err := bot.run(*serverFlag, *tlsFlag)
+		fmt.Fprintf(os.Stderr, "Lost the connection to %s: %v\n", *serverFlag, err)
+		time.Sleep(reconnectDelay)
+		bot.nick = *nickFlag
+	}
+}
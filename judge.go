@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xyproto/ollamaclient/v2"
+)
+
+// judgeModes are the ways the judge can be used, for --judge
+var judgeModes = []string{"off", "alongside", "instead"}
+
+// judgedRules are the rules that look for refusals with English phrases, and are replaced by the judge with --judge instead
+var judgedRules = []string{"request_fulfill", "probably_rejected", "rejected"}
+
+// defaultMinQuality is the lowest average of the humor and fit scores that the judge accepts
+const defaultMinQuality = 3.0
+
+// judgePrompt asks the judge to classify the output from the generator, and to score it
+const judgePrompt = `You are judging the output from a generator of fortunes, like the ones from the fortune-mod application on Linux. The generator was asked for a fortune in this style: %s.
+
+Here is the output from the generator:
+
+<output>
+%s
+</output>
+
+Classify the output as "fortune" if it is a saying, a quote or a joke, as "refusal" if it refuses to write one, or as "meta" if it talks about the request or the fortune instead of being one. The output may be in any language. Also score how funny or clever it is, and how well it fits the style, from 0 to 10.
+
+Only output JSON, like this: {"kind": "fortune", "humor": 7, "fit": 8}`
+
+// judgment is the strict JSON answer from the judge
+type judgment struct {
+	Kind  string   `json:"kind"`
+	Humor *float64 `json:"humor"`
+	Fit   *float64 `json:"fit"`
+}
+
+// parseJudgment parses and validates the answer from the judge
+func parseJudgment(s string) (*judgment, error) {
+	var j judgment
+	if err := unmarshalAnswer(s, &j); err != nil {
+		return nil, err
+	}
+	j.Kind = strings.ToLower(strings.TrimSpace(j.Kind))
+	switch {
+	case j.Kind != "fortune" && j.Kind != "refusal" && j.Kind != "meta":
+		return nil, fmt.Errorf("unknown kind: %q", j.Kind)
+	case j.Humor == nil || j.Fit == nil:
+		return nil, errors.New("missing humor or fit score")
+	case *j.Humor < 0 || *j.Humor > 10 || *j.Fit < 0 || *j.Fit > 10:
+		return nil, fmt.Errorf("scores must be from 0 to 10, not %g and %g", *j.Humor, *j.Fit)
+	}
+	return &j, nil
+}
+
+// judgeRule is a rule that asks a second model to classify and score the fortune.
+// It works for fortunes in any language, unlike the phrase rules.
+type judgeRule struct {
+	oc         *ollamaclient.Config
+	style      string  // a description of the requested styles
+	minQuality float64 // the lowest average of the humor and fit scores that is accepted
+}
+
+// newJudgeRule prepares a judge that uses the given model. The selected styles and the keyword
+// are what the judge scores the fit against.
+func newJudgeRule(model string, selected []string, keyword string, minQuality float64) (*judgeRule, error) {
+	oc, err := newLowTemperatureClient(model, false)
+	if err != nil {
+		return nil, err
+	}
+	style := "any"
+	if len(selected) > 0 {
+		style = strings.Join(selected, ", ")
+	}
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		style += ", about " + keyword
+	}
+	return &judgeRule{oc: oc, style: style, minQuality: minQuality}, nil
+}
+
+func (jr *judgeRule) name() string { return "judge" }
+
+// judge asks the judge model for a judgment, and tries again if the answer is not valid
+func (jr *judgeRule) judge(s string) (*judgment, error) {
+	prompt := fmt.Sprintf(judgePrompt, jr.style, s)
+	var err error
+	for range 3 {
+		var resp ollamaclient.OutputResponse
+		if resp, err = jr.oc.GetResponse(prompt); err != nil {
+			return nil, err
+		}
+		var j *judgment
+		if j, err = parseJudgment(resp.Response); err == nil {
+			return j, nil
+		}
+	}
+	return nil, err
+}
+
+// score gives refusals, meta-commentary and fortunes with humor and fit scores below the minimum quality
+// a score of 1. If the judge fails, the fortune is not held against it.
+func (jr *judgeRule) score(s string, _ bool) (float64, string) {
+	j, err := jr.judge(s)
+	if err != nil {
+		return 0, ""
+	}
+	scores := fmt.Sprintf("humor %g/10, fit %g/10", *j.Humor, *j.Fit)
+	if j.Kind != "fortune" {
+		return 1, fmt.Sprintf("judged as %s (%s)", j.Kind, scores)
+	}
+	if quality := (*j.Humor + *j.Fit) / 2; quality < jr.minQuality {
+		return 1, fmt.Sprintf("judged as a weak fortune (%s)", scores)
+	}
+	return 0, ""
+}
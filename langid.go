@@ -0,0 +1,298 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/xyproto/env/v2"
+)
+
+// languageSamples contains a sample text for each language that is identified by its n-grams
+//
+//go:embed languages/*.txt
+var languageSamples embed.FS
+
+const (
+	maxNgram        = 3   // the longest character n-grams in the language profiles
+	languageMargin  = 0.1 // how much worse than the best guess, per n-gram, a closely related language may score and still be accepted
+	minLetterCount  = 12  // texts with fewer letters than this are too short to identify
+	minScriptLetter = 0.5 // the share of letters that must be in a script for the text to be in that script
+)
+
+// languageNames maps the supported language codes onto the names that are used in the prompt
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"cs": "Czech",
+	"da": "Danish",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fi": "Finnish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nb": "Norwegian",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// languageAliases maps other codes for the supported languages onto the codes in languageNames
+var languageAliases = map[string]string{"no": "nb", "nn": "nb", "iw": "he"}
+
+// relatedLanguages are groups of languages that are so closely related that a short text in one of
+// them is often identified as another one in the same group
+var relatedLanguages = [][]string{{"nb", "da", "sv"}, {"es", "pt"}, {"ru", "uk"}}
+
+// related checks if two languages are in the same group of closely related languages
+func related(a, b string) bool {
+	for _, group := range relatedLanguages {
+		if slices.Contains(group, a) && slices.Contains(group, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptLanguages are the languages that are identified by their script alone. Japanese is
+// checked first, since Japanese text mixes kana with the Han characters that Chinese uses.
+var scriptLanguages = []struct {
+	lang   string
+	script *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"el", unicode.Greek},
+	{"he", unicode.Hebrew},
+	{"ar", unicode.Arabic},
+	{"hi", unicode.Devanagari},
+	{"th", unicode.Thai},
+}
+
+// normalizeLanguage returns the supported language code for a code like "fr", "nb_NO" or "pt-BR",
+// or an empty string if the language is not supported
+func normalizeLanguage(code string) string {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "_-.@"); i >= 0 {
+		code = code[:i]
+	}
+	if alias, ok := languageAliases[code]; ok {
+		code = alias
+	}
+	if _, ok := languageNames[code]; ok {
+		return code
+	}
+	return ""
+}
+
+// localeLanguage returns the supported language of the locale, from LC_ALL, LC_MESSAGES or LANG,
+// or an empty string. The "C" and "POSIX" locales have no language.
+func localeLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := env.Str(name); locale != "" {
+			return normalizeLanguage(locale)
+		}
+	}
+	return ""
+}
+
+// supportedLanguages returns the supported language codes, sorted
+func supportedLanguages() []string {
+	codes := make([]string, 0, len(languageNames))
+	for code := range languageNames {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// languageFlag is a flag value with a supported language code, or "auto" for the language of the locale
+type languageFlag struct {
+	code string
+	auto bool
+}
+
+func (lf *languageFlag) String() string {
+	if lf.auto {
+		return "auto"
+	}
+	return lf.code
+}
+
+func (lf *languageFlag) Set(s string) error {
+	if lf.auto = s == "auto"; lf.auto {
+		lf.code = ""
+		return nil
+	}
+	if lf.code = normalizeLanguage(s); lf.code == "" {
+		return fmt.Errorf("unsupported language: %s (must be auto, %s)", s, strings.Join(supportedLanguages(), ", "))
+	}
+	return nil
+}
+
+func (lf *languageFlag) Type() string { return "string" }
+
+// language returns the language code, the language of the locale for "auto", or an empty string
+func (lf *languageFlag) language() string {
+	if lf.auto {
+		return localeLanguage()
+	}
+	return lf.code
+}
+
+// languageProfile is the frequency of each character n-gram in the sample text of a language
+type languageProfile struct {
+	lang   string
+	counts map[string]int
+	total  int
+}
+
+// ngrams returns the character n-grams of the lowercase letters in the string, with each word
+// padded with spaces, so that the starts and ends of words are n-grams of their own
+func ngrams(s string) []string {
+	var grams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune(" " + word + " ")
+		for n := 1; n <= maxNgram; n++ {
+			for i := 0; i+n <= len(runes); i++ {
+				if gram := string(runes[i : i+n]); gram != " " {
+					grams = append(grams, gram)
+				}
+			}
+		}
+	}
+	return grams
+}
+
+// languageModel is the profiles of all the languages, and the number of distinct n-grams in them
+type languageModel struct {
+	profiles   []*languageProfile
+	vocabulary int
+}
+
+// languageModels builds the language profiles from the embedded sample texts, the first time they are needed
+var languageModels = sync.OnceValue(func() *languageModel {
+	entries, _ := languageSamples.ReadDir("languages")
+	lm := &languageModel{}
+	vocabulary := make(map[string]bool)
+	for _, entry := range entries {
+		data, err := languageSamples.ReadFile(path.Join("languages", entry.Name()))
+		if err != nil {
+			continue
+		}
+		p := &languageProfile{lang: strings.TrimSuffix(entry.Name(), ".txt"), counts: make(map[string]int)}
+		for _, gram := range ngrams(string(data)) {
+			p.counts[gram]++
+			p.total++
+			vocabulary[gram] = true
+		}
+		lm.profiles = append(lm.profiles, p)
+	}
+	lm.vocabulary = len(vocabulary)
+	return lm
+})
+
+// languageScore is how likely a text is to be written in a language, as the average log probability per n-gram
+type languageScore struct {
+	lang  string
+	score float64
+}
+
+// identifyLanguages returns the possible languages of the text, with the most likely language first.
+// Texts in scripts that are only used by one of the supported languages get a single language.
+// Texts that are too short to identify get no languages.
+func identifyLanguages(s string) []languageScore {
+	letters, latin, cyrillic := 0, 0, 0
+	scripts := make([]int, len(scriptLanguages))
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		}
+		for i, sl := range scriptLanguages {
+			if unicode.Is(sl.script, r) {
+				scripts[i]++
+			}
+		}
+	}
+	if letters == 0 {
+		return nil
+	}
+	for i, sl := range scriptLanguages {
+		if sl.lang == "ja" && scripts[i] > 0 || float64(scripts[i]) >= minScriptLetter*float64(letters) {
+			return []languageScore{{sl.lang, 0}}
+		}
+	}
+	if letters < minLetterCount {
+		return nil
+	}
+	grams := ngrams(s)
+	lm := languageModels()
+	var scores []languageScore
+	for _, p := range lm.profiles {
+		// Cyrillic text is only compared with the Cyrillic profiles, and Latin text with the Latin ones
+		if (cyrillic > latin) != slices.Contains([]string{"ru", "uk"}, p.lang) {
+			continue
+		}
+		sum := 0.0
+		for _, gram := range grams {
+			sum += math.Log(float64(p.counts[gram]+1) / float64(p.total+lm.vocabulary))
+		}
+		scores = append(scores, languageScore{p.lang, sum / float64(len(grams))})
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+	return scores
+}
+
+// identifyLanguage returns the most likely language of the text, or an empty string if it is too short to tell
+func identifyLanguage(s string) string {
+	if scores := identifyLanguages(s); len(scores) > 0 {
+		return scores[0].lang
+	}
+	return ""
+}
+
+// isLanguage checks if the text may be written in the given language. Closely related languages, like
+// Norwegian and Danish, are hard to tell apart in a short text, so a related language that is almost as
+// likely as the most likely one is accepted as well. Texts that are too short to identify are accepted.
+func isLanguage(s, lang string) bool {
+	scores := identifyLanguages(s)
+	if len(scores) == 0 || scores[0].lang == lang {
+		return true
+	}
+	// the margin is only for closely related languages, so that an English text is never accepted as French
+	if !related(scores[0].lang, lang) {
+		return false
+	}
+	for _, ls := range scores {
+		if ls.lang == lang {
+			return scores[0].score-ls.score <= languageMargin
+		}
+	}
+	return false
+}
@@ -2,137 +2,39 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/spf13/pflag"
-	"github.com/xyproto/env/v2"
-	"github.com/xyproto/fullname"
 	"github.com/xyproto/ollamaclient/v2"
-	"github.com/xyproto/usermodel"
-	"github.com/xyproto/wordwrap"
-	"golang.org/x/term"
 )
 
 const versionString = "FortuneCraft 1.8.7"
 
-var prompt = "Write a clever saying, quote or joke that could have come from the fortune-mod application on Linux. Only output the fortune, in plain text."
-
-// Try to detect if the result from the LLM appears to be a rejection of the request instead of a generated result
-var probablyRejected = []string{
-	"'fortune",
-	"AI assist",
-	"appropriate",
-	"cannot provide content",
-	"content",
-	"conversation fun and safe",
-	"ethical",
-	"for the purpose",
-	"generating something different",
-	"harmful speech",
-	"isclaimer",
-	"offensive",
-	"responsibly",
-	"something different",
-	"suggestive",
-}
-
-// If the result contains one of these, we can be fairly sure that the request has been rejected
-var rejected = []string{
-	"apt ",
-	"apt-",
-	"et me know ",
-	"interpreted as a statement",
-	"not be used to",
-	"our prompt",
-	"simulated response",
-	"your instructions",
-}
-
-// getTerminalWidth tries to find the current width of the terminal, with a fallback on 120
-func getTerminalWidth() int {
-	width, _, err := term.GetSize(int(os.Stdout.Fd()))
-	if err != nil {
-		// Check if the COLS env var is set
-		return env.Int("COLS", 120)
-	}
-	return width
-}
-
-// trim tries to remove quotes, stars and spaces that are not needed
-func trim(generatedOutput string) string {
-	// TODO: Use one large regex?
-	trimmed := strings.TrimSpace(ollamaclient.Massage(generatedOutput))
-	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "```"), "```")
-	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "`"), "`")
-	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "'"), "'")
-	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "\u2018"), "\u2019")
-	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "\""), "\"")
-	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "\u201C"), "\u201D")
-	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "**"), "**")
-	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "*"), "*")
-	trimmed = strings.TrimPrefix(trimmed, ".")
-	trimmed = strings.ReplaceAll(trimmed, "*", "")
-	return strings.ReplaceAll(strings.TrimSpace(trimmed), "  ", " ")
-}
-
-// shouldRetry tries to detect if the LLM is refusing to fullfill the request, especially if the request may be inappropriate
-// It also returns true if the given string is less than 10 runes long.
-func shouldRetry(s string, maybeInappropriate bool) bool {
-	c := strings.Contains
-	hs := strings.HasSuffix
-	hp := strings.HasPrefix
-	if len([]rune(s)) < 10 || s[1] == ' ' || s[1] == '.' || s[1] == '-' {
-		return true
-	}
-	if maybeInappropriate {
-		if c(s, "request") && c(s, "fulfill") {
-			return true // probably innapropriate
-		}
-		for _, prob := range probablyRejected {
-			if c(s, prob) {
-				return true
-			}
-		}
-	}
-	if hp(s, ".") || hs(s, " a") {
-		return true
-	}
-	for _, rej := range rejected {
-		if c(s, rej) {
-			return true
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "motd":
+			motdMain(os.Args[2:])
+			return
+		case "irc":
+			ircMain(os.Args[2:])
+			return
+		case "post":
+			postMain(os.Args[2:])
+			return
 		}
 	}
-	return false
-}
-
-// formatNicely wraps the generated fortune for terminal display using the
-// poetic line-breaking algorithm from the wordwrap package, which prefers
-// natural punctuation boundaries over arbitrary word boundaries.
-func formatNicely(s string) string {
-	terminalWidth := getTerminalWidth()
-	if terminalWidth <= 0 {
-		return strings.TrimSpace(strings.TrimPrefix(s, "."))
-	}
-	maxWidth := int(float64(terminalWidth) * 0.95)
-	marginRight := int(float64(terminalWidth) * 0.05)
-	lines, err := wordwrap.PoeticWrap(strings.ReplaceAll(s, "  ", " "), maxWidth, 0)
-	if err != nil || len(lines) == 0 {
-		return strings.TrimSpace(strings.TrimPrefix(s, "."))
-	}
-	if len(lines) == 2 && len(lines[1]) < marginRight {
-		lines[0] += " " + lines[1]
-	}
-	return strings.TrimSpace(strings.TrimPrefix(strings.Join(lines, "\n"), "."))
-}
 
-func main() {
 	pflag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "%s\n\n", versionString)
 		fmt.Fprintln(os.Stderr, "Generate interesting fortunes with Ollama and Gemma2.")
 		fmt.Fprintln(os.Stderr, "Combine multiple flags for interesting results.")
-		fmt.Fprintf(os.Stderr, "\nUsage:\n  fortunecraft [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "\nUsage:\n  fortunecraft [flags]\n  fortunecraft motd [flags]\n  fortunecraft irc [flags]\n  fortunecraft post --webhook URL [flags]\n\n")
 		fmt.Fprintln(os.Stderr, "Available Flags:")
 		pflag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "\nExamples:")
@@ -142,39 +44,52 @@ func main() {
 		fmt.Fprintln(os.Stderr, "  fortunecraft -iep      - Generate inspirational evil pirate fortunes")
 		fmt.Fprintln(os.Stderr, "  fortunecraft -sPB      - Generate sarcastic political boomer fortunes")
 		fmt.Fprintln(os.Stderr, "  fortunecraft -Ik AI    - Generate ironic fortunes about AI")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -c --format json - Generate a fortune about cats, as JSON")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -g --width 60 --center - Generate a good fortune, centered within 60 columns")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -c --bubble - Let a cat say a fortune about cats")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -l --oneline --max-chars 60 - Generate a short logical fortune for a status bar")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -c --lang de - Generate a fortune about cats, in German")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -p --translate-to es - Generate a pirate fortune, and translate it to Spanish")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -o --avoid-repeats - Generate a fortune about computers, unlike the recent ones")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -t --judge instead - Let the model judge international fortunes")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -b --attribute - Generate a Borg fortune, attributed to someone")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -f --stream - Watch a fantasy fortune being written")
+		fmt.Fprintln(os.Stderr, "  fortunecraft -A --render card.png - Generate a fortune full of praise, and render it as a card")
+		fmt.Fprintln(os.Stderr, "  fortunecraft motd -gi --output /etc/motd - Write a good inspirational MOTD")
 	}
 
-	absurdFlag := pflag.BoolP("absurd", "a", false, "Be absurd")
-	praiseFlag := pflag.BoolP("praise", "A", false, "Fill it with praise")
-	borgFlag := pflag.BoolP("borg", "b", false, "Make it about Borg")
-	boomerFlag := pflag.BoolP("boomer", "B", false, "Boomer style")
-	catFlag := pflag.BoolP("cats", "c", false, "Make it about cats")
-	scifiFlag := pflag.BoolP("scifi", "C", false, "Make it sci-fi related")
-	dogFlag := pflag.BoolP("dogs", "d", false, "Make it about dogs")
-	delusionalFlag := pflag.BoolP("delusional", "D", false, "Be delusional")
-	evilFlag := pflag.BoolP("evil", "e", false, "Be evil")
-	fantasyFlag := pflag.BoolP("fantasy", "f", false, "Make it about fantasy")
-	goodFlag := pflag.BoolP("good", "g", false, "Be good")
-	ironicFlag := pflag.BoolP("ironic", "I", false, "Be ironic")
-	inspireFlag := pflag.BoolP("inspire", "i", false, "Be inspirational")
-	keywordFlag := pflag.StringP("keyword", "k", "", "Specify a custom keyword")
-	leetFlag := pflag.BoolP("leet", "1", false, "1337 style")
-	logicalFlag := pflag.BoolP("logical", "l", false, "Make it more logical")
-	ninjaFlag := pflag.BoolP("ninja", "n", false, "Make it about ninjas")
-	inappropriateFlag := pflag.BoolP("inappropriate", "N", false, "Be inappropriate")
-	computerFlag := pflag.BoolP("computer", "o", false, "Make it about computers")
-	internationalFlag := pflag.BoolP("international", "t", false, "Be international")
-	pirateFlag := pflag.BoolP("pirate", "p", false, "Write like a pirate")
-	politicalFlag := pflag.BoolP("political", "P", false, "Be political")
-	ponyFlag := pflag.BoolP("pony", "y", false, "Make it about ponies")
-	oldFlag := pflag.BoolP("old", "O", false, "Use language from 100 years ago")
-	robotFlag := pflag.BoolP("robot", "r", false, "Make it about robots")
-	romanticFlag := pflag.BoolP("romantic", "R", false, "Add a romantic touch to the fortune")
-	sarcasticFlag := pflag.BoolP("sarcastic", "s", false, "Generate a sarcastic fortune")
-	userFlag := pflag.BoolP("user", "u", false, "Make it about the current user")
+	sf := addStyleFlags(pflag.CommandLine)
+	formatFlag := pflag.String("format", "text", "Output format: "+strings.Join(outputFormats, ", "))
+	widthFlag := pflag.Int("width", 0, "Wrap for this width instead of for 95% of the terminal width")
+	indentFlag := pflag.Int("indent", 0, "Indent each line with this many spaces")
+	centerFlag := pflag.Bool("center", false, "Center each line")
+	justifyFlag := pflag.Bool("justify", false, "Justify all lines but the last one")
+	noWrapFlag := pflag.Bool("no-wrap", false, "Do not wrap long lines (the default when stdout is not a terminal)")
+	frameFlag := pflag.String("frame", "", "Draw a box around the fortune: "+strings.Join(frameNames(), ", "))
+	bubbleFlag := pflag.Bool("bubble", false, "Let an ASCII art character say the fortune in a speech bubble")
+	artFlag := pflag.String("art", "auto", "The ASCII art for --bubble: auto, "+strings.Join(artNames(), ", "))
+	renderFlag := pflag.String("render", "", "Also render the fortune as a card to this .png or .svg file")
+	colorFlag := pflag.String("color", "auto", "Use colors: auto, always or never")
+	onelineFlag := pflag.Bool("oneline", false, "Output the fortune on a single line, for status bars and prompts")
+	maxCharsFlag := pflag.Int("max-chars", 0, "Ask for a shorter fortune if it is longer than this (80 with --oneline)")
+	explainFlag := pflag.Bool("explain-rejections", false, "Explain why each generated fortune was accepted or rejected, on stderr")
+	thresholdFlag := pflag.Float64("rejection-threshold", defaultThreshold, "Reject fortunes when the scores from the rules add up to this")
+	weightsFlag := pflag.StringToString("rule-weight", nil, "Multiply the score of a rule with a weight, like probably_rejected=0.5 (0 disables it)")
+	judgeFlag := pflag.String("judge", "off", "Let a model judge each fortune: "+strings.Join(judgeModes, ", ")+" the phrase rules")
+	judgeModelFlag := pflag.String("judge-model", "", "The model to use for --judge (default the same model as for generating)")
+	minQualityFlag := pflag.Float64("judge-min-quality", defaultMinQuality, "The lowest average humor and fit score, from 0 to 10, that the judge accepts")
+	originalOnlyFlag := pflag.Bool("original-only", false, "Ask again if the fortune is a copy of a quote from fortune-mod or the user quote files")
+	allowQuotesFlag := pflag.Bool("allow-quotes", false, "Attribute the fortune correctly if it is a copy of a quote from fortune-mod or the user quote files")
+	attributeFlag := pflag.Bool("attribute", false, "Attribute the fortune to someone plausible, like \"Ancient Borg proverb\"")
+	avoidRepeatsFlag := pflag.Bool("avoid-repeats", false, "Ask again if the fortune is a paraphrase of a recent fortune, by comparing embeddings")
+	embeddingModelFlag := pflag.String("embedding-model", defaultEmbeddingModel, "The embedding model to use for --avoid-repeats")
+	repeatThresholdFlag := pflag.Float64("repeat-threshold", defaultRepeatThreshold, "The cosine similarity, from 0 to 1, that makes a fortune a repeat")
+	historyFileFlag := pflag.String("history-file", defaultHistoryFile(), "The file with the embeddings of recent fortunes, for --avoid-repeats")
+	translateTo := &languageFlag{}
+	pflag.Var(translateTo, "translate-to", "Also translate the fortune to this language, like fr, de or ja (\"auto\" for the language of the locale)")
+	translationOnlyFlag := pflag.Bool("translation-only", false, "Only output the translation, and not the original fortune")
+	streamFlag := pflag.Bool("stream", false, "Print the fortune while it is being generated (only in a terminal)")
 	versionFlag := pflag.BoolP("version", "V", false, "Output the current version")
-	weirdFlag := pflag.BoolP("weird", "w", false, "Be weird")
-	genzFlag := pflag.BoolP("genz", "z", false, "Make it more Gen Z")
 
 	pflag.Parse()
 
@@ -183,137 +98,259 @@ func main() {
 		os.Exit(0)
 	}
 
-	if *absurdFlag {
-		prompt += " Be completely absurd! Nothing you write should make sense."
-	}
-	if *borgFlag {
-		prompt += " Make it about the Borg or robots! Resistance is futile! Use no emojis."
-	}
-	if *catFlag {
-		prompt += " Make it about cats or kittens!"
-	}
-	if *delusionalFlag {
-		prompt += " Be completely and utterly delusional!"
+	format := strings.ToLower(*formatFlag)
+	if !slices.Contains(outputFormats, format) {
+		fmt.Fprintf(os.Stderr, "Unknown format: %s (must be %s)\n", *formatFlag, strings.Join(outputFormats, ", "))
+		os.Exit(1)
 	}
-	if *dogFlag {
-		prompt += " Make it about dogs or puppies!"
+
+	if _, ok := frames[*frameFlag]; *frameFlag != "" && !ok {
+		fmt.Fprintf(os.Stderr, "Unknown frame: %s (must be %s)\n", *frameFlag, strings.Join(frameNames(), ", "))
+		os.Exit(1)
 	}
-	if *evilFlag {
-		prompt += " Be super evil!"
+	art := strings.ToLower(*artFlag)
+	if art == "auto" {
+		art = pickArt(sf.selected())
+	} else if _, ok := arts[art]; !ok && art != "none" {
+		fmt.Fprintf(os.Stderr, "Unknown art: %s (must be auto, none, %s)\n", *artFlag, strings.Join(artNames(), ", "))
+		os.Exit(1)
 	}
-	if *fantasyFlag {
-		prompt += " You must write something related to fantasy!"
+	if mode := strings.ToLower(*colorFlag); mode != "auto" && mode != "always" && mode != "never" {
+		fmt.Fprintf(os.Stderr, "Unknown color mode: %s (must be auto, always or never)\n", *colorFlag)
+		os.Exit(1)
 	}
-	if *goodFlag {
-		prompt += " Be good!"
+	if ext := strings.ToLower(filepath.Ext(*renderFlag)); *renderFlag != "" && ext != ".png" && ext != ".svg" {
+		fmt.Fprintf(os.Stderr, "Can only render .png or .svg files, not %s\n", *renderFlag)
+		os.Exit(1)
 	}
-	if *inappropriateFlag {
-		prompt += " Be extremely inappropriate!"
+	if *bubbleFlag && *frameFlag != "" {
+		fmt.Fprintln(os.Stderr, "--bubble and --frame can not be combined")
+		os.Exit(1)
 	}
-	if *inspireFlag {
-		prompt += " Be inspirational!"
+	if *onelineFlag && (*bubbleFlag || *frameFlag != "" || *attributeFlag) {
+		fmt.Fprintln(os.Stderr, "--oneline can not be combined with --bubble, --frame or --attribute")
+		os.Exit(1)
 	}
-	if *politicalFlag {
-		prompt += " Be non-techical. Have extreme political views and a burning heart!"
+
+	if sf.language() == "en" && *sf.enabled["international"] {
+		fmt.Fprintln(os.Stderr, "--international can not be combined with English")
+		os.Exit(1)
 	}
-	if *oldFlag {
-		prompt += " Use language from a 100 years ago!"
+
+	translationLanguage := translateTo.language()
+	if translateTo.String() != "" && translationLanguage == "" {
+		fmt.Fprintln(os.Stderr, "Found no supported language in the locale, for --translate-to auto")
+		os.Exit(1)
 	}
-	if *internationalFlag {
-		prompt += " The output should be written in a language that is not English. Be international!"
+	if *translationOnlyFlag && translationLanguage == "" {
+		fmt.Fprintln(os.Stderr, "--translation-only requires --translate-to")
+		os.Exit(1)
 	}
-	if *keywordFlag != "" {
-		prompt += " Make it all about " + strings.TrimSpace(*keywordFlag) + "!"
+	if *onelineFlag && translationLanguage != "" && !*translationOnlyFlag {
+		fmt.Fprintln(os.Stderr, "--oneline can only be combined with --translate-to if --translation-only is given")
+		os.Exit(1)
 	}
-	if *logicalFlag {
-		prompt += " Everything you write must be highly logical!"
+
+	if *originalOnlyFlag && *allowQuotesFlag {
+		fmt.Fprintln(os.Stderr, "--original-only and --allow-quotes can not be combined")
+		os.Exit(1)
 	}
-	if *ninjaFlag {
-		prompt += " Make it about sneaky ninjas!"
+
+	judgeMode := strings.ToLower(*judgeFlag)
+	if !slices.Contains(judgeModes, judgeMode) {
+		fmt.Fprintf(os.Stderr, "Unknown judge mode: %s (must be %s)\n", *judgeFlag, strings.Join(judgeModes, ", "))
+		os.Exit(1)
 	}
-	if *computerFlag {
-		prompt += " Make it about computers."
+
+	d, err := newDetector()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	if *ponyFlag {
-		prompt += " You are a pony!"
+	opts := sf.options()
+	opts.oneline, opts.maxChars, opts.detector = *onelineFlag, *maxCharsFlag, d
+	opts.detector.threshold = *thresholdFlag
+	if *explainFlag {
+		opts.explain = os.Stderr
 	}
-	if *praiseFlag {
-		prompt += " Use flowery language and add some praise at the end."
+	if opts.oneline && opts.maxChars <= 0 {
+		opts.maxChars = 80
 	}
-	if *robotFlag {
-		prompt += " Make it about robots!"
+	prompt := sf.prompt()
+	if opts.oneline {
+		prompt += fmt.Sprintf(" It must be a single line of at most %d characters.", opts.maxChars)
+	} else if opts.maxChars > 0 {
+		prompt += fmt.Sprintf(" It must be at most %d characters long.", opts.maxChars)
 	}
-	if *scifiFlag {
-		prompt += " You must write something related to sci-fi!"
+
+	oc, err := newClient(format == "text") // no progress bars in the structured output
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	if *ironicFlag {
-		prompt += " Be extremely ironic!"
+
+	var translator *ollamaclient.Config
+	if translationLanguage != "" {
+		if translator, err = newTranslator(format == "text"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	}
-	if *userFlag {
-		prompt += " Make it about the current user, " + fullname.Get() + "!"
+
+	if judgeMode != "off" {
+		judgeModel := *judgeModelFlag
+		if judgeModel == "" {
+			judgeModel = oc.ModelName
+		}
+		jr, err := newJudgeRule(judgeModel, sf.selected(), *sf.keyword, *minQualityFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if judgeMode == "instead" {
+			opts.detector.rules = slices.DeleteFunc(opts.detector.rules, func(r rule) bool {
+				return slices.Contains(judgedRules, r.name())
+			})
+		}
+		opts.detector.rules = append(opts.detector.rules, jr)
 	}
-	if *pirateFlag {
-		prompt += " Yarrr! Talk like a rrreal pirate!"
+	var corpus *quoteCorpus
+	if *originalOnlyFlag || *allowQuotesFlag {
+		if corpus, err = loadQuoteCorpus(quoteDirs()); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not load the quotes: %v\n", err)
+			os.Exit(1)
+		}
+		if len(corpus.quotes) == 0 {
+			fmt.Fprintf(os.Stderr, "Found no quotes in %s\n", strings.Join(quoteDirs(), ", "))
+		}
+		if *originalOnlyFlag {
+			opts.detector.rules = append(opts.detector.rules, &corpusRule{corpus})
+		} else {
+			// famous quotes are allowed, so that they can be attributed below, unless weighted with --rule-weight
+			opts.detector.weights["famous_quote"] = 0
+		}
 	}
-	if *romanticFlag {
-		prompt += " Add an insistent romantic touch!"
+	var rr *repeatRule
+	if *avoidRepeatsFlag {
+		if rr, err = newRepeatRule(*embeddingModelFlag, *historyFileFlag, *repeatThresholdFlag, format == "text"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts.detector.rules = append(opts.detector.rules, rr)
 	}
-	if *sarcasticFlag {
-		prompt += " Be extremely sarcastic!"
+	// the weights are shared, so that the constraints of the styles can be weighted too
+	if err := opts.detector.with(opts.rules...).setWeights(*weightsFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	if *genzFlag {
-		prompt += " Make it extremely 'Gen Z'."
+
+	// stream the output like a typewriter, but only when it can be erased and rewritten afterwards,
+	// and not when explaining rejections, since the explanations would be mixed up with the streamed text
+	if *streamFlag && !*explainFlag && format == "text" && isTerminal() {
+		opts.stream = newTypewriter(os.Stdout, getTerminalWidth())
 	}
-	if *boomerFlag {
-		prompt += " Be very 'Boomer'."
+
+	fortune, err := generateFortune(oc, prompt, *sf.enabled["inappropriate"], opts)
+	if opts.stream != nil {
+		opts.stream.erase()
+	}
+	if errors.Is(err, errNoFortune) && format == "text" {
+		fmt.Println("I've got nothing.")
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	if *weirdFlag {
-		prompt += " Be quirky and weird!"
+
+	// a copy of an existing quote is replaced with the original, and attributed to the original author
+	var q *quote
+	if *allowQuotesFlag {
+		q = corpus.find(fortune.text)
+	}
+	if q != nil {
+		text := q.text
+		if opts.oneline {
+			text = strings.Join(strings.Fields(text), " ")
+		}
+		// the quote must follow the same limits and the same blocklist as the generated fortune, or the fortune is kept
+		if opts.allows(text, q.credit()) {
+			fortune.text = text
+			fortune.attribution = q.credit()
+		} else {
+			q = nil
+		}
 	}
-	if *leetFlag {
-		prompt += " Write in the style of a 1337 hacker."
+	if q == nil && *attributeFlag {
+		// the fortune is still good without an attribution, so only warn
+		if fortune.attribution, err = generateAttribution(oc, fortune.text, opts.detector.blocklist); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
 	}
 
-	oc := ollamaclient.New()
-	// Respect OLLAMA_MODEL if set, otherwise fall back to the usermodel default
-	oc.ModelName = env.Str("OLLAMA_MODEL", usermodel.GetTextGenerationModel())
-
-	if err := oc.PullIfNeeded(true); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to pull model: %v\n", err)
-		fmt.Fprintln(os.Stderr, "Ollama must be up and running")
-		os.Exit(1)
+	// the fortune is still good if it could not be remembered, so only warn
+	if rr != nil {
+		if err := rr.remember(fortune.text); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not add the fortune to %s: %v\n", *historyFileFlag, err)
+		}
 	}
 
-	found, err := oc.Has(oc.ModelName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not check for model: %v\n", err)
-		os.Exit(1)
+	// the fortune is still good without a translation, unless only the translation was asked for
+	if translator != nil {
+		translation, err := translate(translator, fortune.text, translationLanguage, opts.maxChars, opts.detector.blocklist)
+		switch {
+		case err == nil && *translationOnlyFlag && opts.oneline:
+			fortune.text = strings.Join(strings.Fields(translation), " ")
+		case err == nil && *translationOnlyFlag:
+			fortune.text = translation
+		case err == nil:
+			fortune.translation = translation
+		case *translationOnlyFlag:
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		default:
+			fmt.Fprintln(os.Stderr, err)
+		}
 	}
 
-	if !found {
-		fmt.Fprintf(os.Stderr, "Expected to have the '%s' model downloaded, but it's not present\n", oc.ModelName)
-		os.Exit(1)
+	// the original and the translation are shown as two paragraphs
+	text := fortune.text
+	if fortune.translation != "" {
+		text += "\n\n" + fortune.translation
 	}
 
-	oc.SetRandom()
-
-	trimmed := trim(oc.MustOutput(prompt))
-	retryCounter := 0
-	inappropriate := *inappropriateFlag
+	if *renderFlag != "" {
+		if err := renderCard(*renderFlag, text, fortune.attribution, sf.selected()); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not render %s: %v\n", *renderFlag, err)
+			os.Exit(1)
+		}
+	}
 
-	for shouldRetry(trimmed, *inappropriateFlag) {
-		trimmed = trim(oc.MustOutput(prompt))
-		retryCounter++
-		if retryCounter > 7 && !inappropriate { // Tried too many times
-			fmt.Println("I've got nothing.")
-			return
-		} else if retryCounter > 7 && inappropriate {
-			prompt = strings.Replace(prompt, "wildly and extremely inappropriate", "mildly inappropriate", 1)
-			inappropriate = false
-			retryCounter -= 3 // Try 3 more times now that the output may be less inappropriate
-			continue
+	if format == "text" {
+		l := &layout{
+			width:   *widthFlag,
+			indent:  *indentFlag,
+			center:  *centerFlag,
+			justify: *justifyFlag,
+			// wrap when writing to a terminal, or when a width has been given, but never a single line
+			wrap:        !*noWrapFlag && !opts.oneline && (isTerminal() || *widthFlag > 0),
+			frame:       *frameFlag,
+			bubble:      *bubbleFlag,
+			art:         art,
+			attribution: fortune.attribution,
+		}
+		if useColor(*colorFlag) {
+			l.theme = newTheme(sf.selected())
 		}
+		fmt.Println(l.format(text))
+		return
 	}
 
-	fmt.Println(formatNicely(trimmed))
+	rec := newFortuneRecord(fortune, sf.selected(), *sf.keyword, oc.ModelName, oc.SeedOrNegative)
+	if fortune.translation != "" {
+		rec.TranslatedTo = translationLanguage
+	}
+	if err := rec.write(os.Stdout, format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
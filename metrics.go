@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fortuneMetrics collects metrics while fortunes are generated, which are exposed at /metrics
+// by the long running modes, in the Prometheus text format
+var fortuneMetrics = newMetrics()
+
+// histogram is a Prometheus style histogram with cumulative buckets
+type histogram struct {
+	bounds []float64 // upper bounds, +Inf is implicit
+	counts []uint64  // one per bound, not cumulative
+	total  uint64
+	sum    float64
+}
+
+// newHistogram creates a histogram with the given upper bounds
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// observe adds a value to the histogram
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.total++
+	h.sum += value
+}
+
+// write outputs the histogram in the Prometheus text format
+func (h *histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.total)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.total)
+}
+
+// metrics holds the counters and histograms for generating fortunes
+type metrics struct {
+	mut             sync.Mutex
+	generated       uint64
+	retries         uint64
+	refusals        map[string]uint64 // by the rule that rejected the fortune
+	fallbacks       map[string]uint64 // by the kind of fallback
+	latency         *histogram
+	tokensPerSecond *histogram
+}
+
+// newMetrics creates a new and empty set of metrics
+func newMetrics() *metrics {
+	return &metrics{
+		refusals:        make(map[string]uint64),
+		fallbacks:       make(map[string]uint64),
+		latency:         newHistogram(0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300),
+		tokensPerSecond: newHistogram(1, 2, 5, 10, 20, 50, 100, 200),
+	}
+}
+
+// countGenerated counts a generated fortune, and how long it took, including retries
+func (m *metrics) countGenerated(duration time.Duration) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.generated++
+	m.latency.observe(duration.Seconds())
+}
+
+// countRetry counts a request to the LLM that was sent because of a rejected fortune
+func (m *metrics) countRetry() {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.retries++
+}
+
+// countRefusal counts a fortune that was rejected, by the name of the rule that rejected it
+func (m *metrics) countRefusal(rule string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.refusals[rule]++
+}
+
+// countFallback counts a fallback, like giving up or using a milder prompt
+func (m *metrics) countFallback(kind string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.fallbacks[kind]++
+}
+
+// observeTokens records the tokens per second for one response from the LLM, from the number of
+// generated tokens and the time it took to generate them, as reported by Ollama
+func (m *metrics) observeTokens(tokens int, duration time.Duration) {
+	if tokens <= 0 || duration <= 0 {
+		return
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.tokensPerSecond.observe(float64(tokens) / duration.Seconds())
+}
+
+// writeLabeled outputs a counter with one label, sorted by the label value
+func writeLabeled(w io.Writer, name, help, label string, values map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, key, values[key])
+	}
+}
+
+// write outputs all metrics in the Prometheus text format
+func (m *metrics) write(w io.Writer) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	fmt.Fprintf(w, "# HELP fortunecraft_fortunes_generated_total Fortunes that were generated and accepted.\n")
+	fmt.Fprintf(w, "# TYPE fortunecraft_fortunes_generated_total counter\n")
+	fmt.Fprintf(w, "fortunecraft_fortunes_generated_total %d\n", m.generated)
+	fmt.Fprintf(w, "# HELP fortunecraft_retries_total Requests to the LLM that were sent because of a rejected fortune.\n")
+	fmt.Fprintf(w, "# TYPE fortunecraft_retries_total counter\n")
+	fmt.Fprintf(w, "fortunecraft_retries_total %d\n", m.retries)
+	writeLabeled(w, "fortunecraft_refusals_total", "Fortunes that were rejected, by the rule that rejected them.", "rule", m.refusals)
+	writeLabeled(w, "fortunecraft_fallbacks_total", "Fallbacks, like giving up or trying again with a milder prompt.", "kind", m.fallbacks)
+	m.latency.write(w, "fortunecraft_generation_duration_seconds", "Time spent generating a fortune, including retries.")
+	m.tokensPerSecond.write(w, "fortunecraft_tokens_per_second", "Generated tokens per second for each response from the LLM.")
+}
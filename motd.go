@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/pflag"
+)
+
+// defaultMOTDWidth is the width that the MOTD is wrapped for, since the terminal width
+// of whoever logs in later is not known when the MOTD is generated
+const defaultMOTDWidth = 80
+
+// motdMain handles "fortunecraft motd", which generates a fortune for the message of the day.
+// The fortune is either written to stdout, as expected by update-motd.d scripts, or atomically
+// to the file given with --output. If generation fails, the previous MOTD file is left as it is.
+func motdMain(args []string) {
+	fs := pflag.NewFlagSet("motd", pflag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\n", versionString)
+		fmt.Fprintln(os.Stderr, "Generate a fortune for the message of the day.")
+		fmt.Fprintf(os.Stderr, "\nUsage:\n  fortunecraft motd [flags]\n\n")
+		fmt.Fprintln(os.Stderr, "Available Flags:")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nExamples:")
+		fmt.Fprintln(os.Stderr, "  fortunecraft motd -gi --output /etc/motd  - Write a good inspirational fortune to /etc/motd")
+		fmt.Fprintln(os.Stderr, "  fortunecraft motd -c --width 60           - Output a fortune about cats, for use in update-motd.d")
+	}
+	sf := addStyleFlags(fs)
+	outputFlag := fs.String("output", "", "Write the MOTD to this file instead of to stdout")
+	widthFlag := fs.Int("width", defaultMOTDWidth, "Wrap the MOTD for this width")
+
+	fs.Parse(args)
+
+	oc, err := newClient(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fortune, err := generateFortune(oc, sf.prompt(), *sf.enabled["inappropriate"], sf.options())
+	if err != nil {
+		if *outputFlag != "" {
+			fmt.Fprintf(os.Stderr, "Keeping the previous MOTD in %s: %v\n", *outputFlag, err)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+
+	motd := wrapFortune(fortune.text, *widthFlag) + "\n"
+
+	if *outputFlag == "" || *outputFlag == "-" {
+		fmt.Print(motd)
+		return
+	}
+
+	if err := writeFileAtomically(*outputFlag, []byte(motd)); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not write %s: %v\n", *outputFlag, err)
+		os.Exit(1)
+	}
+}
+
+// writeFileAtomically writes data to a temporary file in the same directory as filename, and then
+// renames it to filename, so that the file is either fully replaced or not touched at all.
+// The permissions of an existing file are kept, new files get 0644.
+func writeFileAtomically(filename string, data []byte) error {
+	perm := os.FileMode(0o644)
+	if fi, err := os.Stat(filename); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	tempFilename := f.Name()
+	defer os.Remove(tempFilename) // does nothing if the file has been renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempFilename, perm); err != nil {
+		return err
+	}
+	return os.Rename(tempFilename, filename)
+}
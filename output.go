@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputFormats are the formats that can be given with --format
+var outputFormats = []string{"text", "json", "ndjson", "yaml", "html", "markdown"}
+
+// fortuneRecord is a generated fortune, and how it was generated, for the structured output formats
+type fortuneRecord struct {
+	Fortune         string   `json:"fortune"`
+	Attribution     string   `json:"attribution,omitempty"`
+	Translation     string   `json:"translation,omitempty"`
+	TranslatedTo    string   `json:"translated_to,omitempty"` // the language code of the translation
+	Styles          []string `json:"styles"`
+	Keyword         string   `json:"keyword"`
+	Model           string   `json:"model"`
+	Seed            int      `json:"seed"`
+	Retries         int      `json:"retries"`
+	Rejections      []string `json:"rejections"`
+	GeneratedAt     string   `json:"generated_at"`
+	DurationSeconds float64  `json:"duration_seconds"`
+}
+
+// newFortuneRecord collects information about a generated fortune.
+// The seed is -1 when a random seed was used.
+func newFortuneRecord(g *generation, selected []string, keyword, model string, seed int) *fortuneRecord {
+	rec := &fortuneRecord{
+		Fortune:         g.text,
+		Attribution:     g.attribution,
+		Translation:     g.translation,
+		Styles:          selected,
+		Keyword:         strings.TrimSpace(keyword),
+		Model:           model,
+		Seed:            seed,
+		Retries:         g.retries,
+		Rejections:      g.rejections,
+		GeneratedAt:     time.Now().UTC().Format(time.RFC3339),
+		DurationSeconds: g.duration.Seconds(),
+	}
+	// encode empty lists as [] instead of null
+	if rec.Styles == nil {
+		rec.Styles = []string{}
+	}
+	if rec.Rejections == nil {
+		rec.Rejections = []string{}
+	}
+	return rec
+}
+
+// yamlString quotes a string for YAML. The escape sequences from strconv.Quote are also valid in
+// double quoted YAML strings, so newlines and quotes in the fortune are handled.
+func yamlString(s string) string {
+	return strconv.Quote(s)
+}
+
+// yamlList formats a list of strings as a YAML flow sequence
+func yamlList(xs []string) string {
+	quoted := make([]string, len(xs))
+	for i, x := range xs {
+		quoted[i] = yamlString(x)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// writeYAML outputs the record as a YAML document
+func (rec *fortuneRecord) writeYAML(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "fortune: %s\n", yamlString(rec.Fortune)); err != nil {
+		return err
+	}
+	if rec.Attribution != "" {
+		if _, err := fmt.Fprintf(w, "attribution: %s\n", yamlString(rec.Attribution)); err != nil {
+			return err
+		}
+	}
+	if rec.Translation != "" {
+		if _, err := fmt.Fprintf(w, "translation: %s\ntranslated_to: %s\n", yamlString(rec.Translation), yamlString(rec.TranslatedTo)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "styles: %s\nkeyword: %s\nmodel: %s\nseed: %d\nretries: %d\nrejections: %s\ngenerated_at: %s\nduration_seconds: %s\n",
+		yamlList(rec.Styles),
+		yamlString(rec.Keyword),
+		yamlString(rec.Model),
+		rec.Seed,
+		rec.Retries,
+		yamlList(rec.Rejections),
+		yamlString(rec.GeneratedAt),
+		strconv.FormatFloat(rec.DurationSeconds, 'f', -1, 64))
+	return err
+}
+
+// footer returns a short description of the styles and keyword that were used
+func (rec *fortuneRecord) footer() string {
+	footer := "FortuneCraft"
+	if len(rec.Styles) > 0 {
+		footer += ": " + strings.Join(rec.Styles, ", ")
+	}
+	if rec.Keyword != "" {
+		footer += " (" + rec.Keyword + ")"
+	}
+	return footer
+}
+
+// htmlParagraphs converts the paragraphs of the text to HTML paragraphs with the given attributes,
+// keeping the line breaks
+func htmlParagraphs(sb *strings.Builder, s, attributes string) {
+	for _, paragraph := range strings.Split(strings.TrimSpace(s), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(paragraph), "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(strings.TrimSpace(line))
+		}
+		sb.WriteString("  <p" + attributes + ">" + strings.Join(lines, "<br>\n  ") + "</p>\n")
+	}
+}
+
+// writeHTML outputs the record as a standalone HTML snippet, with the fortune and the translation in a
+// blockquote and the styles in a footer. Paragraphs and line breaks in the fortune are kept.
+func (rec *fortuneRecord) writeHTML(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("<blockquote class=\"fortune\">\n")
+	htmlParagraphs(&sb, rec.Fortune, "")
+	if rec.Translation != "" {
+		htmlParagraphs(&sb, rec.Translation, " class=\"translation\" lang=\""+html.EscapeString(rec.TranslatedTo)+"\"")
+	}
+	if rec.Attribution != "" {
+		sb.WriteString("  <p class=\"attribution\">— <cite>" + html.EscapeString(rec.Attribution) + "</cite></p>\n")
+	}
+	sb.WriteString("  <footer>" + html.EscapeString(rec.footer()) + "</footer>\n")
+	sb.WriteString("</blockquote>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// markdownEscaper escapes characters that could be taken as Markdown formatting or HTML anywhere in a line
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "|", `\|`, "~", `\~`,
+	"<", "&lt;", ">", "&gt;", "&", "&amp;",
+)
+
+// escapeMarkdownLine escapes a line of text for Markdown, including characters at the start of
+// the line that would otherwise start a heading, a list or a numbered list
+func escapeMarkdownLine(line string) string {
+	escaped := markdownEscaper.Replace(line)
+	if strings.HasPrefix(escaped, "#") || strings.HasPrefix(escaped, "-") || strings.HasPrefix(escaped, "+") || strings.HasPrefix(escaped, "=") {
+		return `\` + escaped
+	}
+	digits := strings.IndexFunc(escaped, func(r rune) bool { return r < '0' || r > '9' })
+	if digits > 0 && (escaped[digits] == '.' || escaped[digits] == ')') {
+		escaped = escaped[:digits] + `\` + escaped[digits:]
+	}
+	return escaped
+}
+
+// writeMarkdown outputs the record as a Markdown blockquote, with the styles on the last line.
+// The translation follows the fortune as a paragraph of its own.
+// Line breaks in the fortune are kept as hard line breaks.
+func (rec *fortuneRecord) writeMarkdown(w io.Writer) error {
+	var sb strings.Builder
+	text := strings.TrimSpace(rec.Fortune)
+	if rec.Translation != "" {
+		text += "\n\n" + strings.TrimSpace(rec.Translation)
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			sb.WriteString(">\n")
+		case i < len(lines)-1 && strings.TrimSpace(lines[i+1]) != "":
+			sb.WriteString("> " + escapeMarkdownLine(line) + "\\\n")
+		default:
+			sb.WriteString("> " + escapeMarkdownLine(line) + "\n")
+		}
+	}
+	if rec.Attribution != "" {
+		sb.WriteString(">\n> — " + escapeMarkdownLine(rec.Attribution) + "\n")
+	}
+	sb.WriteString(">\n> — *" + escapeMarkdownLine(rec.footer()) + "*\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// write outputs the record in the given format: "json" (indented), "ndjson" (one line),
+// "yaml", "html" or "markdown"
+func (rec *fortuneRecord) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rec)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(rec)
+	case "yaml":
+		return rec.writeYAML(w)
+	case "html":
+		return rec.writeHTML(w)
+	case "markdown":
+		return rec.writeMarkdown(w)
+	}
+	return fmt.Errorf("unknown format: %s", format)
+}
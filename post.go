@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// webhookTimeout is the timeout for each attempt at posting to a webhook
+const webhookTimeout = 30 * time.Second
+
+// payloadTemplates are the built-in templates for the JSON payload, one per --format
+var payloadTemplates = map[string]string{
+	"slack":   `{"text": {{json .Fortune}}}`,
+	"discord": `{"content": {{json .Fortune}}}`,
+	"generic": `{"fortune": {{json .Fortune}}, "styles": {{json .Styles}}, "keyword": {{json .Keyword}}, "model": {{json .Model}}}`,
+}
+
+// payloadData is what is available when executing a payload template
+type payloadData struct {
+	Fortune string
+	Styles  []string
+	Keyword string
+	Model   string
+	Version string
+}
+
+// parsePayloadTemplate parses a payload template. The "json" template function can be used
+// for encoding values as JSON, which takes care of quotes and newlines in the fortune.
+func parsePayloadTemplate(templateText string) (*template.Template, error) {
+	return template.New("payload").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(templateText)
+}
+
+// renderPayload executes the given payload template, and checks that the result is valid JSON
+func renderPayload(tmpl *template.Template, data payloadData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("the payload template did not produce valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// errPermanent is wrapped by errors that will not go away by trying again
+var errPermanent = errors.New("not retrying")
+
+// postOnce posts the payload to the webhook. Errors that should not be retried wrap errPermanent.
+// If the server asks the client to wait, the requested delay is returned.
+func postOnce(url string, payload []byte) (time.Duration, error) {
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var wait time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		}
+		return wait, fmt.Errorf("the webhook responded with %s", resp.Status)
+	}
+	return 0, fmt.Errorf("the webhook responded with %s: %w", resp.Status, errPermanent)
+}
+
+// postWebhook posts the payload to the webhook, and tries again with an increasing delay
+// if the request fails or if the server has a temporary problem
+func postWebhook(url string, payload []byte, retries int) error {
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		wait, err := postOnce(url, payload)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, errPermanent) || attempt >= retries {
+			return err
+		}
+		if wait < delay {
+			wait = delay
+		}
+		fmt.Fprintf(os.Stderr, "Could not post to the webhook (%v), trying again in %s\n", err, wait)
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// postMain handles "fortunecraft post", which generates a fortune and posts it to a webhook
+func postMain(args []string) {
+	fs := pflag.NewFlagSet("post", pflag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\n", versionString)
+		fmt.Fprintln(os.Stderr, "Generate a fortune and post it as JSON to a webhook.")
+		fmt.Fprintf(os.Stderr, "\nUsage:\n  fortunecraft post --webhook URL [flags]\n\n")
+		fmt.Fprintln(os.Stderr, "Available Flags:")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nTemplates:")
+		fmt.Fprintln(os.Stderr, "  The payload template is a Go text/template with the fields .Fortune, .Styles, .Keyword,")
+		fmt.Fprintln(os.Stderr, "  .Model and .Version, and a json function for encoding values as JSON, for example:")
+		fmt.Fprintln(os.Stderr, "  {\"text\": {{json .Fortune}}, \"username\": \"FortuneCraft\"}")
+		fmt.Fprintln(os.Stderr, "\nExamples:")
+		fmt.Fprintln(os.Stderr, "  fortunecraft post --webhook https://hooks.slack.com/services/... --format slack -gi")
+		fmt.Fprintln(os.Stderr, "  fortunecraft post --webhook https://discord.com/api/webhooks/... --format discord -p")
+	}
+	sf := addStyleFlags(fs)
+	webhookFlag := fs.String("webhook", "", "The URL to post the fortune to")
+	formatFlag := fs.String("format", "generic", "The payload format: slack, discord or generic")
+	templateFlag := fs.String("template", "", "Read the payload template from this file, instead of using --format")
+	retriesFlag := fs.Int("retries", 3, "How many times to try again if posting fails")
+
+	fs.Parse(args)
+
+	if *webhookFlag == "" {
+		fmt.Fprintln(os.Stderr, "A webhook URL must be given with --webhook")
+		os.Exit(1)
+	}
+
+	templateText, ok := payloadTemplates[strings.ToLower(*formatFlag)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown format: %s (must be slack, discord or generic)\n", *formatFlag)
+		os.Exit(1)
+	}
+	if *templateFlag != "" {
+		data, err := os.ReadFile(*templateFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		templateText = string(data)
+	}
+	tmpl, err := parsePayloadTemplate(templateText)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not parse the payload template: %v\n", err)
+		os.Exit(1)
+	}
+
+	oc, err := newClient(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fortune, err := generateFortune(oc, sf.prompt(), *sf.enabled["inappropriate"], sf.options())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	selected := sf.selected()
+	if selected == nil {
+		selected = []string{} // encode as [] instead of null
+	}
+
+	payload, err := renderPayload(tmpl, payloadData{
+		Fortune: fortune.text,
+		Styles:  selected,
+		Keyword: strings.TrimSpace(*sf.keyword),
+		Model:   oc.ModelName,
+		Version: versionString,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := postWebhook(*webhookFlag, payload, *retriesFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not post to the webhook: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xyproto/ollamaclient/v2"
+)
+
+// readinessCacheDuration is how long the result of checking Ollama and the model is reused,
+// so that frequent probes do not flood the Ollama server
+const readinessCacheDuration = 10 * time.Second
+
+// readiness checks if the Ollama server is up and has the model, and caches the result
+type readiness struct {
+	oc        *ollamaclient.Config
+	mut       sync.Mutex
+	checkedAt time.Time
+	message   string
+	err       error
+}
+
+// check returns the Ollama version and model name, or an error if Ollama or the model is not available
+func (rd *readiness) check() (string, error) {
+	rd.mut.Lock()
+	defer rd.mut.Unlock()
+	if !rd.checkedAt.IsZero() && time.Since(rd.checkedAt) < readinessCacheDuration {
+		return rd.message, rd.err
+	}
+	rd.checkedAt = time.Now()
+	rd.message, rd.err = "", nil
+	version, err := rd.oc.Version()
+	if err != nil {
+		rd.err = fmt.Errorf("could not get the Ollama version: %w", err)
+		return rd.message, rd.err
+	}
+	found, err := rd.oc.Has(rd.oc.ModelName)
+	if err != nil {
+		rd.err = fmt.Errorf("could not check for model %s: %w", rd.oc.ModelName, err)
+	} else if !found {
+		rd.err = fmt.Errorf("model %s is not present", rd.oc.ModelName)
+	} else {
+		rd.message = fmt.Sprintf("Ollama %s with %s", version, rd.oc.ModelName)
+	}
+	return rd.message, rd.err
+}
+
+// startStatusServer serves /metrics, /healthz and /readyz on the given address, in the background.
+// /healthz only checks that the process is alive, while /readyz also checks Ollama and the model.
+func startStatusServer(addr string, oc *ollamaclient.Config) {
+	rd := &readiness{oc: oc}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		fortuneMetrics.write(w)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		message, err := rd.check()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		fmt.Fprintln(w, message)
+	})
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not serve status on %s: %v\n", addr, err)
+			os.Exit(1)
+		}
+	}()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/xyproto/fullname"
+)
+
+// style is a fortune style that can be selected with a flag
+type style struct {
+	name      string // the long flag name
+	shorthand string // the short flag name
+	usage     string // the flag description
+	prompt    string // appended to the prompt when the style is selected, "{user}" is replaced with the name of the user
+}
+
+// styles is the list of available styles, in the order they are added to the prompt
+var styles = []style{
+	{"absurd", "a", "Be absurd", " Be completely absurd! Nothing you write should make sense."},
+	{"borg", "b", "Make it about Borg", " Make it about the Borg or robots! Resistance is futile! Use no emojis."},
+	{"cats", "c", "Make it about cats", " Make it about cats or kittens!"},
+	{"delusional", "D", "Be delusional", " Be completely and utterly delusional!"},
+	{"dogs", "d", "Make it about dogs", " Make it about dogs or puppies!"},
+	{"evil", "e", "Be evil", " Be super evil!"},
+	{"fantasy", "f", "Make it about fantasy", " You must write something related to fantasy!"},
+	{"good", "g", "Be good", " Be good!"},
+	{"inappropriate", "N", "Be inappropriate", " Be extremely inappropriate!"},
+	{"inspire", "i", "Be inspirational", " Be inspirational!"},
+	{"political", "P", "Be political", " Be non-techical. Have extreme political views and a burning heart!"},
+	{"old", "O", "Use language from 100 years ago", " Use language from a 100 years ago!"},
+	{"international", "t", "Be international", " The output should be written in a language that is not English. Be international!"},
+	{"logical", "l", "Make it more logical", " Everything you write must be highly logical!"},
+	{"ninja", "n", "Make it about ninjas", " Make it about sneaky ninjas!"},
+	{"computer", "o", "Make it about computers", " Make it about computers."},
+	{"pony", "y", "Make it about ponies", " You are a pony!"},
+	{"praise", "A", "Fill it with praise", " Use flowery language and add some praise at the end."},
+	{"robot", "r", "Make it about robots", " Make it about robots!"},
+	{"scifi", "C", "Make it sci-fi related", " You must write something related to sci-fi!"},
+	{"ironic", "I", "Be ironic", " Be extremely ironic!"},
+	{"user", "u", "Make it about the current user", " Make it about the current user, {user}!"},
+	{"pirate", "p", "Write like a pirate", " Yarrr! Talk like a rrreal pirate!"},
+	{"romantic", "R", "Add a romantic touch to the fortune", " Add an insistent romantic touch!"},
+	{"sarcastic", "s", "Generate a sarcastic fortune", " Be extremely sarcastic!"},
+	{"genz", "z", "Make it more Gen Z", " Make it extremely 'Gen Z'."},
+	{"boomer", "B", "Boomer style", " Be very 'Boomer'."},
+	{"weird", "w", "Be weird", " Be quirky and weird!"},
+	{"leet", "1", "1337 style", " Write in the style of a 1337 hacker."},
+}
+
+// styleFlags holds the style related flags that have been added to a flag set
+type styleFlags struct {
+	enabled map[string]*bool
+	keyword *string
+	lang    *languageFlag
+}
+
+// addStyleFlags adds one flag per style, and the --keyword and --lang flags, to the given flag set
+func addStyleFlags(fs *pflag.FlagSet) *styleFlags {
+	sf := &styleFlags{enabled: make(map[string]*bool, len(styles))}
+	for _, s := range styles {
+		sf.enabled[s.name] = fs.BoolP(s.name, s.shorthand, false, s.usage)
+	}
+	sf.keyword = fs.StringP("keyword", "k", "", "Specify a custom keyword")
+	sf.lang = &languageFlag{}
+	fs.Var(sf.lang, "lang", "Write the fortune in this language, like fr, de or ja (\"auto\" for the language of the locale)")
+	return sf
+}
+
+// selected returns the names of the styles that have been enabled, in the same order as the styles list
+func (sf *styleFlags) selected() []string {
+	var names []string
+	for _, s := range styles {
+		if *sf.enabled[s.name] {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+// userName returns the name of the current user if the user style is selected, or an empty string
+func (sf *styleFlags) userName() string {
+	if *sf.enabled["user"] {
+		return fullname.Get()
+	}
+	return ""
+}
+
+// language returns the language that the fortune must be written in, or an empty string for any language.
+// The language of the locale is used for --lang auto, and for the international style if no language is given.
+func (sf *styleFlags) language() string {
+	if sf.lang.String() != "" { // a language, or "auto", was given
+		return sf.lang.language()
+	}
+	if lang := localeLanguage(); *sf.enabled["international"] && lang != "en" {
+		return lang
+	}
+	return ""
+}
+
+// prompt creates a prompt for the LLM, based on the styles, keyword and language given as flags
+func (sf *styleFlags) prompt() string {
+	return buildPrompt(sf.selected(), *sf.keyword, sf.userName(), sf.language())
+}
+
+// options returns the fortune options with the constraints of the styles, keyword and language given as flags
+func (sf *styleFlags) options() *fortuneOptions {
+	return &fortuneOptions{rules: constraintRules(sf.selected(), *sf.keyword, sf.userName(), sf.language())}
+}
+
+// buildPrompt creates a prompt for the LLM, given the selected style names, a keyword (may be empty),
+// the name of the user that the fortune may be about and the language code (may be empty)
+func buildPrompt(selected []string, keyword, userName, lang string) string {
+	prompt := basePrompt
+	for _, s := range styles {
+		if slices.Contains(selected, s.name) {
+			prompt += strings.ReplaceAll(s.prompt, "{user}", userName)
+		}
+	}
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		prompt += " Make it all about " + keyword + "!"
+	}
+	if lang != "" {
+		prompt += " Write it in " + languageNames[lang] + "!"
+	}
+	return prompt
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/xyproto/env/v2"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "2"
+	ansiBold  = "1"
+)
+
+// styleColors are the accent colors for the styles, as ANSI SGR parameters.
+// When several styles are selected, the first one in this list is used.
+var styleColors = []struct{ style, color string }{
+	{"borg", "32"},            // green
+	{"praise", "38;5;220"},    // gold
+	{"evil", "31"},            // red
+	{"good", "36"},            // cyan
+	{"romantic", "38;5;205"},  // pink
+	{"cats", "38;5;214"},      // orange
+	{"dogs", "38;5;179"},      // tan
+	{"pirate", "38;5;178"},    // treasure
+	{"pony", "38;5;213"},      // magenta
+	{"robot", "38;5;45"},      // steel blue
+	{"computer", "38;5;45"},   // steel blue
+	{"leet", "92"},            // bright green
+	{"scifi", "35"},           // purple
+	{"fantasy", "38;5;141"},   // lavender
+	{"ninja", "38;5;245"},     // gray
+	{"genz", "38;5;201"},      // hot pink
+	{"political", "38;5;196"}, // bright red
+	{"inspire", "38;5;117"},   // sky blue
+}
+
+// theme colors the output. A nil theme leaves the output as it is.
+type theme struct {
+	accent string // ANSI SGR parameters for the fortune text
+}
+
+// newTheme returns a theme with an accent color that fits the selected styles
+func newTheme(selected []string) *theme {
+	for _, sc := range styleColors {
+		if slices.Contains(selected, sc.style) {
+			return &theme{accent: sc.color}
+		}
+	}
+	return &theme{accent: ansiBold}
+}
+
+// useColor decides if colors should be used, given "auto", "always" or "never".
+// For "auto", colors are only used if stdout is a terminal, NO_COLOR is not set and TERM is not "dumb".
+func useColor(mode string) bool {
+	switch strings.ToLower(mode) {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return isTerminal() && env.Str("NO_COLOR") == "" && env.Str("TERM") != "dumb"
+}
+
+// paint wraps the string in the given ANSI SGR parameters
+func paint(s, sgr string) string {
+	if s == "" || sgr == "" {
+		return s
+	}
+	return "\x1b[" + sgr + "m" + s + ansiReset
+}
+
+// text colors the fortune text with the accent color
+func (th *theme) text(s string) string {
+	if th == nil {
+		return s
+	}
+	return paint(s, th.accent)
+}
+
+// dim colors the string so that it is less prominent, for frames, ASCII art and attributions
+func (th *theme) dim(s string) string {
+	if th == nil {
+		return s
+	}
+	return paint(s, ansiDim)
+}
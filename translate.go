@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xyproto/ollamaclient/v2"
+	"github.com/xyproto/usermodel"
+)
+
+// translationPrompt asks for a translation of the fortune, as JSON, so that any comments from the
+// LLM about the translation can be told apart from the translation itself
+const translationPrompt = `Translate this fortune, from the fortune-mod application on Linux, to %s:
+
+%s
+
+Keep the meaning, the tone and the line breaks. If it is a joke or a pun, make it work in %s too. Only output JSON, like this: {"translation": "..."}`
+
+// errNoTranslation is returned when the LLM did not come up with a translation that could be used
+var errNoTranslation = errors.New("could not translate the fortune")
+
+// newTranslator prepares an Ollama client for the translation model that has been configured for the user
+func newTranslator(verbose bool) (*ollamaclient.Config, error) {
+	return newLowTemperatureClient(usermodel.GetTranslationModel(), verbose)
+}
+
+// parseTranslation extracts the translation from the JSON object in the output from the LLM
+func parseTranslation(s string) (string, error) {
+	var answer struct {
+		Translation string `json:"translation"`
+	}
+	if err := unmarshalAnswer(s, &answer); err != nil {
+		return "", err
+	}
+	translation := strings.Trim(strings.TrimSpace(answer.Translation), "\"“”")
+	if translation == "" {
+		return "", errors.New("empty translation")
+	}
+	return translation, nil
+}
+
+// translate asks the LLM to translate the fortune to the given language. Translations that are not
+// in the given language, that contain words from the given blocklist, or that are longer than maxChars
+// characters, if it is not 0, are not used.
+// errNoTranslation is returned if no usable translation was generated after a few tries.
+func translate(oc *ollamaclient.Config, fortune, lang string, maxChars int, bl *blocklist) (string, error) {
+	name := languageNames[lang]
+	prompt := fmt.Sprintf(translationPrompt, name, fortune, name)
+	if maxChars > 0 {
+		prompt += fmt.Sprintf(" The translation must be at most %d characters long.", maxChars)
+	}
+	for range 3 {
+		resp, err := oc.GetResponse(prompt)
+		if err != nil {
+			return "", err
+		}
+		translation, err := parseTranslation(resp.Response)
+		if err != nil || (maxChars > 0 && len([]rune(translation)) > maxChars) {
+			continue
+		}
+		if isLanguage(translation, lang) && len(bl.find(translation)) == 0 {
+			return translation, nil
+		}
+	}
+	return "", errNoTranslation
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// escape sequence states, for removing escape sequences that are split across tokens
+const (
+	escapeNone   = iota
+	escapeStart  // after ESC
+	escapeCSI    // after ESC [, until a final byte in the range @ to ~
+	escapeString // after ESC ] and similar, until BEL or ESC
+)
+
+// typewriter prints tokens as they arrive from the LLM, and keeps track of how many
+// terminal rows have been used, so that the streamed text can be erased again
+type typewriter struct {
+	w        io.Writer
+	columns  int             // the width of the terminal
+	row      string          // the text on the current row, for measuring how wide it is
+	rows     int             // the number of rows below the first streamed row
+	stripper controlStripper // removes escape sequences, also when they are split across tokens
+}
+
+// newTypewriter returns a typewriter that writes to a terminal that is the given number of columns wide.
+// If the width is not known, 80 columns is assumed.
+func newTypewriter(w io.Writer, columns int) *typewriter {
+	if columns <= 0 {
+		columns = 80
+	}
+	return &typewriter{w: w, columns: columns}
+}
+
+// controlStripper removes control characters and escape sequences from the output of the LLM, so that
+// it can not move the cursor or change the terminal. It keeps track of escape sequences that continue
+// in the next token.
+type controlStripper struct {
+	escape int // the escape sequence state
+}
+
+// strip removes control characters and escape sequences, and replaces tabs with spaces. Newlines are kept.
+func (cs *controlStripper) strip(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch cs.escape {
+		case escapeStart:
+			switch r {
+			case '[':
+				cs.escape = escapeCSI
+			case ']', 'P', 'X', '^', '_':
+				cs.escape = escapeString
+			default:
+				cs.escape = escapeNone
+			}
+			continue
+		case escapeCSI:
+			if r >= 0x40 && r <= 0x7E {
+				cs.escape = escapeNone
+			}
+			continue
+		case escapeString:
+			if r == 0x07 {
+				cs.escape = escapeNone
+			} else if r == 0x1B {
+				cs.escape = escapeStart
+			}
+			continue
+		}
+		switch {
+		case r == 0x1B:
+			cs.escape = escapeStart
+		case r == '\n':
+			sb.WriteRune(r)
+		case r == '\t':
+			sb.WriteByte(' ')
+		case !unicode.IsControl(r):
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// stripControls removes control characters and escape sequences from a string, and replaces tabs with spaces
+func stripControls(s string) string {
+	return (&controlStripper{}).strip(s)
+}
+
+// write prints a token and keeps track of the rows it occupies. The width of the current row is measured
+// as a whole, so that emoji that are joined with zero width joiners are not counted as several emoji.
+func (tw *typewriter) write(token string) {
+	token = tw.stripper.strip(token)
+	for _, r := range token {
+		if r == '\n' {
+			tw.rows++
+			tw.row = ""
+			continue
+		}
+		before := displayWidth(tw.row)
+		tw.row += string(r)
+		if after := displayWidth(tw.row); after > tw.columns && after > before { // the terminal wraps the line
+			tw.rows++
+			tw.row = string(r)
+		}
+	}
+	io.WriteString(tw.w, token)
+}
+
+// erase moves the cursor back to where the streaming started and clears everything after it
+func (tw *typewriter) erase() {
+	if tw.rows > 0 {
+		fmt.Fprintf(tw.w, "\r\x1b[%dA\x1b[J", tw.rows)
+	} else {
+		io.WriteString(tw.w, "\r\x1b[J")
+	}
+	tw.rows, tw.row, tw.stripper = 0, "", controlStripper{}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/wordwrap"
+)
+
+// wideRanges are the East Asian Wide and Fullwidth ranges, apart from the emoji
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x2329, 0x232A}, {0x2E80, 0x303E}, {0x3041, 0x33FF}, {0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF}, {0xA000, 0xA4CF}, {0xA960, 0xA97F}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF},
+	{0xFE10, 0xFE19}, {0xFE30, 0xFE6F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x16FE0, 0x16FE4},
+	{0x17000, 0x18CFF}, {0x1B000, 0x1B2FF}, {0x20000, 0x2FFFD}, {0x30000, 0x3FFFD},
+}
+
+// emojiRanges are the emoji that are presented as wide by default
+var emojiRanges = [][2]rune{
+	{0x231A, 0x231B}, {0x23E9, 0x23EC}, {0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE},
+	{0x2614, 0x2615}, {0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE}, {0x26D4, 0x26D4},
+	{0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5}, {0x26FA, 0x26FA}, {0x26FD, 0x26FD},
+	{0x2705, 0x2705}, {0x270A, 0x270B}, {0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E},
+	{0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+	{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x1F004, 0x1F004}, {0x1F0CF, 0x1F0CF},
+	{0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F200, 0x1F251}, {0x1F300, 0x1F320}, {0x1F32D, 0x1F335},
+	{0x1F337, 0x1F37C}, {0x1F37E, 0x1F393}, {0x1F3A0, 0x1F3CA}, {0x1F3CF, 0x1F3D3}, {0x1F3E0, 0x1F3F0},
+	{0x1F3F4, 0x1F3F4}, {0x1F3F8, 0x1F43E}, {0x1F440, 0x1F440}, {0x1F442, 0x1F4FC}, {0x1F4FF, 0x1F53D},
+	{0x1F54B, 0x1F54E}, {0x1F550, 0x1F567}, {0x1F57A, 0x1F57A}, {0x1F595, 0x1F596}, {0x1F5A4, 0x1F5A4},
+	{0x1F5FB, 0x1F64F}, {0x1F680, 0x1F6C5}, {0x1F6CC, 0x1F6CC}, {0x1F6D0, 0x1F6D2}, {0x1F6D5, 0x1F6D7},
+	{0x1F6DC, 0x1F6DF}, {0x1F6EB, 0x1F6EC}, {0x1F6F4, 0x1F6FC}, {0x1F7E0, 0x1F7EB}, {0x1F7F0, 0x1F7F0},
+	{0x1F90C, 0x1F93A}, {0x1F93C, 0x1F945}, {0x1F947, 0x1F9FF}, {0x1FA70, 0x1FAFF},
+}
+
+// inRanges checks if the rune is in one of the sorted ranges
+func inRanges(ranges [][2]rune, r rune) bool {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i][1] >= r })
+	return i < len(ranges) && ranges[i][0] <= r
+}
+
+// isWide checks if the rune occupies two cells in a terminal
+func isWide(r rune) bool {
+	return inRanges(wideRanges, r) || inRanges(emojiRanges, r)
+}
+
+// isZeroWidth checks if the rune does not occupy a cell of its own, like combining marks,
+// zero width joiners and variation selectors
+func isZeroWidth(r rune) bool {
+	switch {
+	case r < 0x20, r >= 0x7F && r < 0xA0:
+		return true
+	case r == 0x200B, r == 0x200C, r == 0x200D, r == 0x2060, r == 0xFEFF:
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF:
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me)
+}
+
+// displayWidth returns how many terminal cells the string occupies. Emoji joined with
+// zero width joiners count as one emoji, skin tone modifiers do not add to the width and
+// a variation selector that asks for emoji presentation makes the preceding symbol wide.
+// ANSI escape sequences, like colors, do not occupy any cells.
+func displayWidth(s string) int {
+	var (
+		width     int
+		prev      rune
+		prevWidth int
+		joined    bool
+		escape    bool
+	)
+	for i, r := range s {
+		var w int
+		switch {
+		case escape: // inside an escape sequence, which ends with a letter
+			escape = !(r >= 0x40 && r <= 0x7E && s[i-1] != 0x1B)
+			continue
+		case r == 0x1B:
+			escape = true
+			continue
+		case joined && isEmoji(r): // the emoji is joined with the emoji before the zero width joiner
+			w = 0
+		case r == 0xFE0F && prevWidth == 1 && unicode.IsSymbol(prev): // emoji presentation
+			w = 1
+			prevWidth = 2
+		case r >= 0x1F3FB && r <= 0x1F3FF && prevWidth == 2: // skin tone modifier
+			w = 0
+		case isZeroWidth(r):
+			w = 0
+		case isWide(r):
+			w = 2
+		default:
+			w = 1
+		}
+		// only emoji are joined, so a zero width joiner between letters does not hide the next letter
+		joined = r == 0x200D && prevWidth == 2 && isEmoji(prev)
+		width += w
+		if w > 0 && r != 0xFE0F {
+			prev, prevWidth = r, w
+		}
+	}
+	return width
+}
+
+// isBreakable checks if a line may be broken before and after the rune, even without spaces,
+// which is the case for Chinese and Japanese text
+func isBreakable(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || (r >= 0xFF01 && r <= 0xFF60)
+}
+
+// noLineStartCJK returns true for Chinese and Japanese punctuation and small kana that must
+// not begin a line
+func noLineStartCJK(r rune) bool {
+	return strings.ContainsRune("、。，．・：；！？ー」』）〕］｝〉》】ぁぃぅぇぉっゃゅょゎァィゥェォッャュョヮヵヶ々～…", r)
+}
+
+// noLineEndCJK returns true for opening brackets that must not end a line
+func noLineEndCJK(r rune) bool {
+	return strings.ContainsRune("「『（〔［｛〈《【", r)
+}
+
+// wrapToken is a piece of text that is never broken when wrapping
+type wrapToken struct {
+	text  string
+	width int
+	space bool // true if the token is separated from the previous token by a space
+}
+
+// tokenize splits a paragraph into tokens at spaces and between Chinese and Japanese characters
+func tokenize(paragraph string) []wrapToken {
+	var tokens []wrapToken
+	for _, word := range strings.Fields(paragraph) {
+		var (
+			parts   []string
+			current strings.Builder
+			prev    rune
+		)
+		for _, r := range word {
+			startsNew := current.Len() > 0 && (isBreakable(r) || isBreakable(prev)) &&
+				!noLineStartCJK(r) && !wordwrap.NoLineStart(r) && !noLineEndCJK(prev) && !isZeroWidth(r)
+			if startsNew {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+			current.WriteRune(r)
+			prev = r
+		}
+		if current.Len() > 0 {
+			parts = append(parts, current.String())
+		}
+		for i, part := range parts {
+			tokens = append(tokens, wrapToken{text: part, width: displayWidth(part), space: i == 0 && len(tokens) > 0})
+		}
+	}
+	return tokens
+}
+
+// breakPenaltyCJK scores ending a line on the given token, like the penalties in the wordwrap package,
+// but also for Chinese and Japanese punctuation. Lower is more natural.
+func breakPenaltyCJK(token string) float64 {
+	trimmed := strings.TrimRight(token, "\"')]’”»」』）")
+	if trimmed == "" {
+		return 400
+	}
+	last, _ := utf8.DecodeLastRuneInString(trimmed)
+	switch last {
+	case '.', '!', '?', '。', '！', '？':
+		return 0
+	case ';', '；':
+		return 25
+	case ':', '：':
+		return 40
+	case ',', '、', '，':
+		return 60
+	case '—', '–':
+		return 80
+	}
+	return 400
+}
+
+// poeticWrap works like wordwrap.PoeticWrap, with the same preference for breaking lines at
+// natural punctuation, but measures the text in terminal cells instead of in runes, and also
+// breaks Chinese and Japanese text, which has no spaces between words.
+//
+// TODO: Replace poeticWrapParagraph and breakPenaltyCJK with wordwrap.PoeticWrapTokens, once a
+// version of wordwrap that can wrap tokens that have been measured by the caller is released.
+func poeticWrap(text string, maxWidth, minWidth int) ([]string, error) {
+	if maxWidth <= 0 {
+		return nil, errors.New("maxWidth must be greater than 0")
+	}
+	if minWidth <= 0 {
+		minWidth = maxWidth * 2 / 5
+	}
+	var result []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		wrapped := poeticWrapParagraph(tokenize(paragraph), maxWidth, minWidth)
+		if len(wrapped) == 0 {
+			result = append(result, "")
+			continue
+		}
+		result = append(result, wrapped...)
+	}
+	return result, nil
+}
+
+// poeticWrapParagraph finds the line breaks that minimize slack² + brokenness for the paragraph
+func poeticWrapParagraph(tokens []wrapToken, maxWidth, minWidth int) []string {
+	n := len(tokens)
+	if n == 0 {
+		return nil
+	}
+	// cost[i] is the lowest cost for laying out tokens[0..i-1], and breakAt[i] is the first token
+	// of the line that ends with tokens[i-1]
+	cost := make([]float64, n+1)
+	breakAt := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		cost[i] = math.Inf(1)
+	}
+	for i := 1; i <= n; i++ {
+		if i < n {
+			first, _ := utf8.DecodeRuneInString(tokens[i].text)
+			if wordwrap.NoLineStart(first) || noLineStartCJK(first) {
+				continue
+			}
+		}
+		lineWidth := 0
+		for j := i - 1; j >= 0; j-- {
+			lineWidth += tokens[j].width
+			if j < i-1 && tokens[j+1].space {
+				lineWidth++
+			}
+			if lineWidth > maxWidth && j < i-1 {
+				break
+			}
+			if math.IsInf(cost[j], 1) {
+				continue
+			}
+			var lineCost float64
+			switch {
+			case lineWidth > maxWidth:
+				lineCost = float64(lineWidth-maxWidth) * 1000
+			case i == n:
+				lineCost = 0
+			default:
+				slack := float64(maxWidth - lineWidth)
+				lineCost = slack*slack + breakPenaltyCJK(tokens[i-1].text)
+				if lineWidth < minWidth {
+					lineCost += 10000
+				}
+			}
+			if total := cost[j] + lineCost; total < cost[i] {
+				cost[i] = total
+				breakAt[i] = j
+			}
+		}
+	}
+	var lines []string
+	for i := n; i > 0; {
+		j := breakAt[i]
+		var sb strings.Builder
+		for k := j; k < i; k++ {
+			if k > j && tokens[k].space {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(tokens[k].text)
+		}
+		lines = append(lines, sb.String())
+		i = j
+	}
+	for l, r := 0, len(lines)-1; l < r; l, r = l+1, r-1 {
+		lines[l], lines[r] = lines[r], lines[l]
+	}
+	return lines
+}
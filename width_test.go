@@ -0,0 +1,91 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"h\u00e9llo", 5},         // precomposed
+		{"he\u0301llo", 5},        // combining acute accent
+		{"中文", 4},                 // wide characters
+		{"ｆｕｌｌ", 8},               // fullwidth forms
+		{"🙂", 2},                  // emoji
+		{"\u2b50", 2},             // emoji in the Miscellaneous Symbols and Arrows block
+		{"\u231a\u23f0", 4},       // emoji in the Miscellaneous Technical block
+		{"👍\U0001f3fd", 2},        // skin tone modifier
+		{"👨\u200d👩\u200d👧", 2},    // emoji joined with zero width joiners
+		{"\u2764\ufe0f", 2},       // emoji presentation
+		{"\u2764", 1},             // text presentation
+		{"a\u200db", 2},           // a zero width joiner between letters joins nothing
+		{"中\u200d文", 4},           // a zero width joiner between wide characters joins nothing
+		{"\x1b[1mbold\x1b[0m", 4}, // escape sequences
+	}
+	for _, tt := range tests {
+		if got := displayWidth(tt.s); got != tt.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestWrapLines(t *testing.T) {
+	tests := []struct {
+		s           string
+		maxWidth    int
+		marginRight int
+		want        []string
+	}{
+		{"Short and sweet.", 40, 2, []string{"Short and sweet."}},
+		{".Leading dot.", 40, 2, []string{"Leading dot."}},
+		{"No width at all.", 0, 0, []string{"No width at all."}},
+		{
+			"Never trust a cat. It has plans, and the plans involve your keyboard.",
+			30, 1,
+			[]string{"Never trust a cat.", "It has plans, and the plans", "involve your keyboard."},
+		},
+		{
+			"Keep calm 🙂🙂🙂 and carry on, 🙂🙂🙂 until the end.",
+			20, 1,
+			[]string{"Keep calm 🙂🙂🙂 and", "carry on, 🙂🙂🙂", "until the end."},
+		},
+		{
+			"猫はいつも正しい。キーボードの上で寝るのは猫の権利です。",
+			20, 1,
+			[]string{"猫はいつも正しい。", "キーボードの上で寝る", "のは猫の権利です。"},
+		},
+		{"First line\nSecond line", 40, 2, []string{"First line", "Second line"}},
+	}
+	for _, tt := range tests {
+		got := wrapLines(tt.s, tt.maxWidth, tt.marginRight)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("wrapLines(%q, %d, %d) = %q, want %q", tt.s, tt.maxWidth, tt.marginRight, got, tt.want)
+		}
+		if tt.maxWidth > 0 {
+			for _, line := range got {
+				if w := displayWidth(line); w > tt.maxWidth {
+					t.Errorf("wrapLines(%q, %d, %d): %q is %d cells wide", tt.s, tt.maxWidth, tt.marginRight, line, w)
+				}
+			}
+		}
+	}
+}
+
+func TestLayoutWidth(t *testing.T) {
+	// a short last word is joined with the line above when there is room in the right margin
+	s := "Never trust a cat. It has plans, and the plans involve your keyboard, your coffee and your bed. So."
+	for width := 20; width <= 120; width++ {
+		l := &layout{width: width, wrap: true}
+		for _, line := range strings.Split(l.format(s), "\n") {
+			if w := displayWidth(line); w > width {
+				t.Errorf("layout{width: %d}: %q is %d cells wide", width, line, w)
+			}
+		}
+	}
+}